@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// archiveLocked moves a product from the stock of the store to its archive.
+// The write lock must be held.
+func (s *store) archiveLocked(p Product) {
+	product := p.Product()
+	s.touch(product)
+	product.deletedAt = product.lastUpdated
+
+	s.removeProductLocked(product.id)
+	s.archived[product.id] = p
+}
+
+// archivedProducts returns the products deleted from the store that have not
+// been purged, from the most recently deleted.
+func (s *store) archivedProducts() []Product {
+	s.mtx.RLock()
+	products := make([]Product, 0, len(s.archived))
+	for _, product := range s.archived {
+		products = append(products, product)
+	}
+	s.mtx.RUnlock()
+
+	sort.SliceStable(products, func(i, j int) bool {
+		if c := compareTimes(products[i].Product().deletedAt, products[j].Product().deletedAt); c != 0 {
+			return c > 0
+		}
+		iID, jID := products[i].ID(), products[j].ID()
+		return bytes.Compare(iID[:], jID[:]) < 0
+	})
+
+	return products
+}
+
+// restoreProduct returns the archived product with the specified ID to the
+// stock of the store.
+func (s *store) restoreProduct(ID productID) error {
+	var event *StoreEvent
+	var watchers []func()
+	defer func() {
+		s.publish(event)
+		notifyStockWatchers(watchers)
+	}()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	archivedProduct, ok := s.archived[ID]
+	if !ok {
+		return fmt.Errorf("%w: product with ID %s has not been deleted", ErrProductNotFound, ID.String())
+	}
+
+	if _, ok := s.products[ID]; ok {
+		return fmt.Errorf("%w: product with ID %s is already in stock", ErrInvalidArgument, ID.String())
+	}
+
+	outOfStock := s.watchedOutOfStockLocked()
+	product := archivedProduct.Product()
+	product.deletedAt = nil
+	s.touch(product)
+
+	delete(s.archived, ID)
+	s.putProductLocked(archivedProduct)
+
+	event = &StoreEvent{Kind: EventProductsAdded, ProductIDs: []productID{ID}}
+	watchers = s.backInStockLocked(outOfStock)
+	return nil
+}
+
+// purgeProducts deletes one or more products from the store for good, whether
+// they are in stock or archived, and returns the number of products purged.
+// Purged products cannot be restored.
+func (s *store) purgeProducts(productIDs ...productID) (int, error) {
+	if len(productIDs) == 0 {
+		return 0, ErrNoProductIDs
+	}
+
+	var event *StoreEvent
+	defer func() { s.publish(event) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var purged int
+	var deletedIDs []productID
+	for _, productID := range productIDs {
+		if _, ok := s.products[productID]; ok {
+			s.removeProductLocked(productID)
+			deletedIDs = append(deletedIDs, productID)
+			purged++
+		} else if _, ok := s.archived[productID]; ok {
+			delete(s.archived, productID)
+			purged++
+		}
+	}
+
+	// Archived products were already reported as deleted.
+	if len(deletedIDs) != 0 {
+		event = &StoreEvent{Kind: EventProductsDeleted, ProductIDs: deletedIDs}
+	}
+
+	return purged, nil
+}
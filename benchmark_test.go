@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// benchmarkCatalogSize is the number of products in the store shared by the
+// benchmarks of store operations.
+const benchmarkCatalogSize = 100_000
+
+var (
+	benchmarkCatalogOnce  sync.Once
+	benchmarkCatalogStore *store
+	benchmarkCatalogBuyer customerID
+	benchmarkCatalogIDs   []productID
+	benchmarkCatalogErr   error
+)
+
+// newBenchmarkProduct returns the i-th product of a benchmark catalog. The
+// products are spread over 10 types and 100 categories.
+func newBenchmarkProduct(i, units int) (*product, error) {
+	return newProduct(fmt.Sprintf("Product %d", i), fmt.Sprintf("type%d", i%10),
+		WithPrice(Money(1000+i)),
+		WithQuantity(units),
+		WithCategory(fmt.Sprintf("Category %d", i%100)),
+		WithDescription("A product for benchmarks."),
+		WithImages("https://example.com/product.png"),
+		WithSpecifications(map[string][]string{"size": {"M"}}))
+}
+
+// benchmarkCatalog returns a store with benchmarkCatalogSize products and a
+// customer, the IDs of the products, and the ID of the customer. The store is
+// seeded once and shared by the benchmarks. Every product has enough units
+// that none sells out while benchmarking sellProduct.
+func benchmarkCatalog(b *testing.B) (*store, customerID, []productID) {
+	b.Helper()
+	benchmarkCatalogOnce.Do(func() {
+		s := newStore("Benchmark Store", CurrencyNGN)
+		buyer, err := s.addCustomer(&customer{name: "Ada Obi", email: "ada@example.com", phone: "+2348000000000"})
+		if err != nil {
+			benchmarkCatalogErr = err
+			return
+		}
+
+		products := make([]Product, benchmarkCatalogSize)
+		for i := range products {
+			if products[i], err = newBenchmarkProduct(i, 1000); err != nil {
+				benchmarkCatalogErr = err
+				return
+			}
+		}
+
+		benchmarkCatalogIDs, benchmarkCatalogErr = s.addProducts(products...)
+		benchmarkCatalogStore, benchmarkCatalogBuyer = s, buyer
+	})
+	if benchmarkCatalogErr != nil {
+		b.Fatalf("error seeding the benchmark store: %v", benchmarkCatalogErr)
+	}
+	b.ResetTimer()
+	return benchmarkCatalogStore, benchmarkCatalogBuyer, benchmarkCatalogIDs
+}
+
+func BenchmarkAddProducts(b *testing.B) {
+	const batchSize = 1000
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		s := newStore("Benchmark Store", CurrencyNGN)
+		products := make([]Product, batchSize)
+		for j := range products {
+			p, err := newBenchmarkProduct(j, 10)
+			if err != nil {
+				b.Fatalf("newProduct error: %v", err)
+			}
+			products[j] = p
+		}
+		b.StartTimer()
+
+		if _, err := s.addProducts(products...); err != nil {
+			b.Fatalf("addProducts error: %v", err)
+		}
+	}
+}
+
+func BenchmarkFilterAvailableProducts(b *testing.B) {
+	s, _, _ := benchmarkCatalog(b)
+
+	b.Run("type", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.availableProducts("type3")
+		}
+	})
+
+	b.Run("category", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.availableProductsByCategory("category 7")
+		}
+	})
+
+	b.Run("price range", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.availableProductsInPriceRange("type3", 2000, 3000)
+		}
+	})
+}
+
+func BenchmarkSellProduct(b *testing.B) {
+	s, buyer, IDs := benchmarkCatalog(b)
+	for i := 0; i < b.N; i++ {
+		_, err := s.sellProduct(&order{
+			customerID:      buyer,
+			amountPaid:      1_000_000,
+			shippingAddress: "1 Marina Road, Lagos",
+			products:        []orderLine{{product: &product{id: IDs[i%len(IDs)]}, quantity: 1}},
+		})
+		if err != nil {
+			b.Fatalf("sellProduct error: %v", err)
+		}
+	}
+}
+
+func BenchmarkSearchProducts(b *testing.B) {
+	s, _, _ := benchmarkCatalog(b)
+
+	b.Run("names", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.searchProducts("product 999", false, false)
+		}
+	})
+
+	b.Run("specifications", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.searchProducts("xl", true, true)
+		}
+	})
+}
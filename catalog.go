@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// Catalog holds product definitions shared by the branches of a chain of
+// stores. Each branch keeps its own stock and orders, and stocks products
+// from the catalog with stockFromCatalog. A product keeps its catalog ID in
+// every branch.
+type Catalog struct {
+	// currency is the currency the prices of all products in the catalog
+	// are denominated in.
+	currency Currency
+	mtx      sync.RWMutex
+	products map[productID]Product
+	branches []*store
+	// idGenerator generates the IDs of new products.
+	idGenerator IDGenerator
+}
+
+// newCatalog creates a new catalog of products priced in the specified
+// currency.
+func newCatalog(currency Currency) *Catalog {
+	return &Catalog{
+		currency:    currency,
+		products:    make(map[productID]Product),
+		idGenerator: RandomIDs(rand.Reader),
+	}
+}
+
+// newBranchStore creates a new store that stocks products from catalog and
+// sells them in the catalog currency.
+func newBranchStore(name string, catalog *Catalog) *store {
+	s := newStore(name, catalog.currency)
+	s.catalog = catalog
+
+	catalog.mtx.Lock()
+	catalog.branches = append(catalog.branches, s)
+	catalog.mtx.Unlock()
+
+	return s
+}
+
+// addProducts adds copies of new product definition(s) to the catalog and
+// returns an array of product IDs. The quantity of the products is ignored, as
+// stock is kept by each branch. Products are normalized like the ones added to
+// a store.
+func (c *Catalog) addProducts(products ...Product) ([]productID, error) {
+	if len(products) == 0 {
+		return nil, ErrNoProducts
+	}
+
+	// Validate products.
+	copies := make([]Product, len(products))
+	for i, p := range products {
+		if p == nil || p.Product() == nil {
+			return nil, ErrInvalidProduct
+		}
+
+		product := copyProduct(p)
+		if product == nil {
+			return nil, fmt.Errorf("%w: unsupported product type %T", ErrInvalidProduct, p)
+		}
+		product.Product().normalize()
+
+		if errs := product.Validate(); len(errs) != 0 {
+			return nil, fmt.Errorf("product at index %d is not valid: %w", i, &ValidationError{Errors: errs})
+		}
+
+		if currency := product.Currency(); currency != "" && currency != c.currency {
+			return nil, fmt.Errorf("%w: product %q is priced in %s but the catalog is in %s", ErrInvalidProduct, product.DisplayName(), currency, c.currency)
+		}
+
+		if parentID := product.Product().parentID; !parentID.IsZero() && c.product(parentID) == nil {
+			return nil, fmt.Errorf("%w: parent product with ID %s of product %q does not exist in the catalog", ErrProductNotFound, parentID.String(), product.DisplayName())
+		}
+		copies[i] = product
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	productIDs := make([]productID, len(copies))
+	for i, p := range copies {
+		ID, err := c.generateProductID()
+		if err != nil {
+			return nil, err
+		}
+
+		product := p.Product()
+		product.id = ID
+		product.currency = c.currency
+		product.quantity = 0
+		product.createdAt = nil
+		product.lastUpdated = nil
+
+		productIDs[i] = ID
+		c.products[ID] = p
+	}
+
+	return productIDs, nil
+}
+
+// product returns a copy of the product definition with the specified ID, or
+// nil if it is not in the catalog.
+func (c *Catalog) product(ID productID) Product {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	if p, ok := c.products[ID]; ok {
+		return copyProduct(p)
+	}
+	return nil
+}
+
+// updateProduct applies fn to the product definition with the specified ID
+// and updates the product in every branch that stocks it. Branch quantities
+// are kept. The product is left unchanged if fn returns an error, leaves the
+// product invalid, or leaves it with a type or more images than a branch that
+// stocks it allows.
+func (c *Catalog) updateProduct(ID productID, fn func(*product) error) error {
+	if fn == nil {
+		return fmt.Errorf("%w: provide a product update function", ErrInvalidArgument)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	catalogProduct, ok := c.products[ID]
+	if !ok {
+		return fmt.Errorf("%w: product with ID %s does not exist in the catalog", ErrProductNotFound, ID.String())
+	}
+
+	// Update a copy, so the definition is unchanged if the update fails.
+	updated := copyProduct(catalogProduct)
+	if err := fn(updated.Product()); err != nil {
+		return err
+	}
+	updated.Product().normalize()
+
+	if updated.ID() != ID {
+		return fmt.Errorf("%w: product ID cannot be updated", ErrInvalidProduct)
+	}
+
+	if errs := updated.Validate(); len(errs) != 0 {
+		return fmt.Errorf("updated product with ID %s is not valid: %w", ID.String(), &ValidationError{Errors: errs})
+	}
+
+	if updated.Currency() != c.currency {
+		return fmt.Errorf("%w: product currency cannot be changed from %s", ErrInvalidProduct, c.currency)
+	}
+
+	// Keep every branch locked until it is updated, so it cannot change
+	// the products it sells after it is checked.
+	for _, branch := range c.branches {
+		branch.mtx.Lock()
+		defer branch.mtx.Unlock()
+	}
+
+	for _, branch := range c.branches {
+		if err := branch.checkCatalogProductLocked(updated); err != nil {
+			return err
+		}
+	}
+
+	c.products[ID] = updated
+	for _, branch := range c.branches {
+		branch.syncCatalogProductLocked(updated)
+	}
+
+	return nil
+}
+
+// generateProductID generates a random non-zero ID that is not used by any
+// product in the catalog. The write lock must be held.
+func (c *Catalog) generateProductID() (productID, error) {
+	var ID productID
+	for i := 0; i < maxIDGenerationAttempts; i++ {
+		if err := c.idGenerator.NewID(ID[:]); err != nil {
+			return zeroProductID, fmt.Errorf("%w: %v", ErrIDGeneration, err)
+		}
+
+		if _, exists := c.products[ID]; !ID.IsZero() && !exists {
+			return ID, nil
+		}
+	}
+
+	return zeroProductID, fmt.Errorf("%w for a product", ErrIDGeneration)
+}
+
+// stockFromCatalog adds units of the catalog product with the specified ID to
+// the store. The product is added with its catalog ID if the store does not
+// have it in stock, and must then pass the same checks as a product added with
+// addProducts.
+func (s *store) stockFromCatalog(ID productID, units int) error {
+	if s.catalog == nil {
+		return fmt.Errorf("%w: %s is not a branch of a catalog", ErrInvalidArgument, s.name)
+	}
+
+	if units <= 0 {
+		return fmt.Errorf("%w: number of units to stock must be positive", ErrInvalidArgument)
+	}
+
+	p := s.catalog.product(ID)
+	if p == nil {
+		return fmt.Errorf("%w: product with ID %s does not exist in the catalog", ErrProductNotFound, ID.String())
+	}
+
+	var event *StoreEvent
+	var watchers []func()
+	defer func() {
+		s.publish(event)
+		notifyStockWatchers(watchers)
+	}()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	outOfStock := s.watchedOutOfStockLocked()
+	if storeProduct, ok := s.products[ID]; ok {
+		product := storeProduct.Product()
+		product.quantity += units
+		s.touch(product)
+		watchers = s.backInStockLocked(outOfStock)
+		return nil
+	}
+
+	product := p.Product()
+	product.quantity = units
+	if errs := p.Validate(); len(errs) != 0 {
+		return fmt.Errorf("catalog product with ID %s is not valid: %w", ID.String(), &ValidationError{Errors: errs})
+	}
+
+	if err := s.checkNewProductLocked(p); err != nil {
+		return err
+	}
+
+	s.touch(product)
+	product.createdAt = product.lastUpdated
+	s.putProductLocked(p)
+
+	event = &StoreEvent{Kind: EventProductsAdded, ProductIDs: []productID{ID}}
+	s.counters.productsAdded.Add(1)
+	watchers = s.backInStockLocked(outOfStock)
+	return nil
+}
+
+// checkCatalogProductLocked checks if the store can sell the updated
+// definition of a catalog product it stocks. The write lock must be held.
+func (s *store) checkCatalogProductLocked(updated Product) error {
+	if _, ok := s.products[updated.ID()]; !ok {
+		return nil
+	}
+
+	if !s.sellsTypeLocked(updated.Type()) {
+		return fmt.Errorf("%w %q: %s does not sell product with ID %s", ErrUnknownProductType, updated.Type(), s.name, updated.ID().String())
+	}
+
+	if len(updated.Images()) > s.maxImages {
+		return fmt.Errorf("%w: updated product with ID %s has %d images but at most %d are allowed in %s", ErrInvalidProduct, updated.ID().String(), len(updated.Images()), s.maxImages, s.name)
+	}
+
+	return nil
+}
+
+// syncCatalogProductLocked replaces the store's copy of a catalog product with
+// the updated definition, keeping its quantity and creation date. Orders that
+// sold the old copy are not changed. The write lock must be held.
+func (s *store) syncCatalogProductLocked(updated Product) {
+	storeProduct, ok := s.products[updated.ID()]
+	if !ok {
+		return
+	}
+
+	p := copyProduct(updated)
+	product := p.Product()
+	product.quantity = storeProduct.Quantity()
+	product.createdAt = storeProduct.Product().createdAt
+	s.touch(product)
+	s.putProductLocked(p)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStockFromCatalog(t *testing.T) {
+	catalog := newCatalog(CurrencyNGN)
+	IDs, err := catalog.addProducts(testProduct(t, "Rice", 1000, 1))
+	if err != nil {
+		t.Fatalf("addProducts error: %v", err)
+	}
+	branch := newBranchStore("Ikeja", catalog)
+
+	var restocked int
+	branch.watchStock("test", func() { restocked++ })
+
+	if err := branch.stockFromCatalog(IDs[0], 3); err != nil {
+		t.Fatalf("stockFromCatalog error: %v", err)
+	}
+	if p := branch.product(IDs[0]); p == nil || p.Quantity() != 3 {
+		t.Fatalf("expected 3 units in stock, got %v", p)
+	}
+	if metrics := branch.metrics(); metrics.ProductsAdded != 1 {
+		t.Fatalf("expected 1 product added, got %d", metrics.ProductsAdded)
+	}
+	if restocked != 1 {
+		t.Fatalf("expected the stock watcher to be called once, got %d", restocked)
+	}
+
+	// Stocking more units of a product in stock does not add a product.
+	if err := branch.stockFromCatalog(IDs[0], 2); err != nil {
+		t.Fatalf("stockFromCatalog error: %v", err)
+	}
+	if p := branch.product(IDs[0]); p.Quantity() != 5 || branch.metrics().ProductsAdded != 1 {
+		t.Fatalf("expected 5 units of 1 product added, got %d units of %d", p.Quantity(), branch.metrics().ProductsAdded)
+	}
+}
+
+func TestStockFromCatalogChecksStore(t *testing.T) {
+	catalog := newCatalog(CurrencyNGN)
+	IDs, err := catalog.addProducts(testProduct(t, "Rice", 1000, 1, WithImages("https://example.com/1.png", "https://example.com/2.png")))
+	if err != nil {
+		t.Fatalf("addProducts error: %v", err)
+	}
+
+	cars := newBranchStore("Cars", catalog)
+	cars.allowedTypes = map[string]bool{"car": true}
+	if err := cars.stockFromCatalog(IDs[0], 1); !errors.Is(err, ErrUnknownProductType) {
+		t.Fatalf("expected ErrUnknownProductType, got %v", err)
+	}
+
+	branch := newBranchStore("Ikeja", catalog)
+	if err := branch.setMaxImages(1); err != nil {
+		t.Fatalf("setMaxImages error: %v", err)
+	}
+	if err := branch.stockFromCatalog(IDs[0], 1); !errors.Is(err, ErrInvalidProduct) {
+		t.Fatalf("expected ErrInvalidProduct, got %v", err)
+	}
+
+	for _, s := range []*store{cars, branch} {
+		if s.product(IDs[0]) != nil || s.metrics().ProductsAdded != 0 {
+			t.Fatalf("%s stocked a product it cannot sell", s.name)
+		}
+	}
+}
+
+func TestCatalogNormalizesName(t *testing.T) {
+	catalog := newCatalog(CurrencyNGN)
+	IDs, err := catalog.addProducts(testProduct(t, "  Ford  Ecosport ", 1000, 1))
+	if err != nil {
+		t.Fatalf("addProducts error: %v", err)
+	}
+	if got := catalog.product(IDs[0]).DisplayName(); got != "Ford Ecosport" {
+		t.Fatalf("expected name %q, got %q", "Ford Ecosport", got)
+	}
+
+	err = catalog.updateProduct(IDs[0], func(p *product) error {
+		p.name = " Ford   Ranger  "
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("updateProduct error: %v", err)
+	}
+	if got := catalog.product(IDs[0]).DisplayName(); got != "Ford Ranger" {
+		t.Fatalf("expected name %q, got %q", "Ford Ranger", got)
+	}
+
+	if _, err := catalog.addProducts(testProduct(t, "   ", 1000, 1)); err == nil {
+		t.Fatalf("added a product with a blank name")
+	}
+}
+
+func TestCatalogUpdateChecksBranches(t *testing.T) {
+	catalog := newCatalog(CurrencyNGN)
+	IDs, err := catalog.addProducts(testProduct(t, "Rice", 1000, 1))
+	if err != nil {
+		t.Fatalf("addProducts error: %v", err)
+	}
+	images := len(catalog.product(IDs[0]).Images())
+
+	food := newBranchStore("Food", catalog)
+	food.allowedTypes = map[string]bool{"test": true}
+	branch := newBranchStore("Ikeja", catalog)
+	if err := branch.setMaxImages(images); err != nil {
+		t.Fatalf("setMaxImages error: %v", err)
+	}
+	for _, s := range []*store{food, branch} {
+		if err := s.stockFromCatalog(IDs[0], 2); err != nil {
+			t.Fatalf("stockFromCatalog error: %v", err)
+		}
+	}
+	// A branch that does not stock the product does not restrict updates.
+	newBranchStore("Cars", catalog).allowedTypes = map[string]bool{"car": true}
+
+	tests := []struct {
+		name   string
+		update func(p *product) error
+		err    error
+	}{
+		{"type a branch does not sell", func(p *product) error {
+			p.productType = "car"
+			return nil
+		}, ErrUnknownProductType},
+		{"more images than a branch allows", func(p *product) error {
+			p.images = append(p.images, "https://example.com/2.png")
+			return nil
+		}, ErrInvalidProduct},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := catalog.updateProduct(IDs[0], test.update); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			if p := catalog.product(IDs[0]); p.Type() != "test" || len(p.Images()) != images {
+				t.Fatalf("catalog product changed by a rejected update: %+v", p)
+			}
+			for _, s := range []*store{food, branch} {
+				if p := s.product(IDs[0]); p.Type() != "test" || len(p.Images()) != images || p.Quantity() != 2 {
+					t.Fatalf("%s product changed by a rejected update: %+v", s.name, p)
+				}
+			}
+		})
+	}
+
+	err = catalog.updateProduct(IDs[0], func(p *product) error {
+		p.name = "Ofada Rice"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("updateProduct error: %v", err)
+	}
+	for _, s := range []*store{food, branch} {
+		if p := s.product(IDs[0]); p.DisplayName() != "Ofada Rice" || p.Quantity() != 2 {
+			t.Fatalf("%s has %q with %d units, want Ofada Rice with 2", s.name, p.DisplayName(), p.Quantity())
+		}
+	}
+}
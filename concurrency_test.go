@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sellOne sells one unit of the product with the specified ID to buyer.
+func sellOne(s *store, buyer customerID, ID productID) error {
+	_, err := s.sellProduct(testOrder(buyer, 1000, orderLine{product: &product{id: ID}, quantity: 1}))
+	return err
+}
+
+func TestConcurrentAddSellDeleteQuery(t *testing.T) {
+	const adders, productsPerAdder, units = 4, 50, 3
+	s, buyer := testStore(t)
+
+	added := make(chan productID, adders*productsPerAdder)
+	var addWG sync.WaitGroup
+	for i := 0; i < adders; i++ {
+		addWG.Add(1)
+		go func(i int) {
+			defer addWG.Done()
+			for j := 0; j < productsPerAdder; j++ {
+				IDs, err := s.addProducts(testProduct(t, fmt.Sprintf("Rice %d-%d", i, j), 1000, units))
+				if err != nil {
+					t.Errorf("addProducts error: %v", err)
+					return
+				}
+				added <- IDs[0]
+			}
+		}(i)
+	}
+	go func() {
+		addWG.Wait()
+		close(added)
+	}()
+
+	// Every product is sold from until it sells out or is deleted, and every
+	// fifth product is deleted, while products are still being added.
+	var mtx sync.Mutex
+	sold, deleted := make(map[productID]int), make(map[productID]bool)
+	toSell, toDelete := make(chan productID, cap(added)), make(chan productID, cap(added))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ID := range toSell {
+				for {
+					err := sellOne(s, buyer, ID)
+					if errors.Is(err, ErrProductNotFound) {
+						break
+					}
+					if err != nil {
+						t.Errorf("sellProduct error: %v", err)
+						break
+					}
+					mtx.Lock()
+					sold[ID]++
+					mtx.Unlock()
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ID := range toDelete {
+			n, err := s.deleteProducts(ID)
+			if err != nil {
+				t.Errorf("deleteProducts error: %v", err)
+			}
+			mtx.Lock()
+			deleted[ID] = n == 1
+			mtx.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	var queryWG sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		queryWG.Add(1)
+		go func() {
+			defer queryWG.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s.availableProducts("")
+				s.searchProducts("rice", true, true)
+				s.inStockCount("test")
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	var IDs []productID
+	for ID := range added {
+		toSell <- ID
+		if IDs = append(IDs, ID); len(IDs)%5 == 0 {
+			toDelete <- ID
+		}
+	}
+	close(toSell)
+	close(toDelete)
+
+	wg.Wait()
+	close(done)
+	queryWG.Wait()
+
+	checkInvariants(t, s)
+
+	// No unit is sold twice, every unit is either sold or archived, and no
+	// sold out or deleted product is still available.
+	if len(IDs) != adders*productsPerAdder {
+		t.Fatalf("%d products were added, want %d", len(IDs), adders*productsPerAdder)
+	}
+	if products, _ := s.availableProducts(""); len(products) != 0 {
+		t.Fatalf("%d products are available after selling or deleting every product", len(products))
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, ID := range IDs {
+		count := sold[ID]
+		if p, ok := s.archived[ID]; ok {
+			if !deleted[ID] {
+				t.Errorf("product with ID %s is archived but was not deleted", ID.String())
+			}
+			count += p.Quantity()
+		}
+		if count != units {
+			t.Errorf("product with ID %s has %d units sold or archived, want %d", ID.String(), count, units)
+		}
+	}
+}
+
+func TestSellProductWhileDeleting(t *testing.T) {
+	s, buyer := testStore(t)
+
+	// A product deleted before the sale is not found.
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1))
+	if _, err := s.deleteProducts(IDs[0]); err != nil {
+		t.Fatalf("deleteProducts error: %v", err)
+	}
+	if err := sellOne(s, buyer, IDs[0]); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("sellProduct error = %v, want ErrProductNotFound", err)
+	}
+
+	// When a sale and deletion of a product race, exactly one of them
+	// succeeds.
+	for i := 0; i < 200; i++ {
+		IDs := mustAddProducts(t, s, testProduct(t, fmt.Sprintf("Beans %d", i), 1000, 1))
+
+		var wg sync.WaitGroup
+		var sellErr error
+		var deleted int
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			sellErr = sellOne(s, buyer, IDs[0])
+		}()
+		go func() {
+			defer wg.Done()
+			var err error
+			if deleted, err = s.deleteProducts(IDs[0]); err != nil {
+				t.Errorf("deleteProducts error: %v", err)
+			}
+		}()
+		wg.Wait()
+
+		switch {
+		case sellErr == nil && deleted == 0:
+		case errors.Is(sellErr, ErrProductNotFound) && deleted == 1:
+		default:
+			t.Fatalf("sellProduct error %v and %d products deleted, want exactly one to succeed", sellErr, deleted)
+		}
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSellProductValidationWithConcurrentWriters(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 1000))
+
+	done := make(chan struct{})
+	var writers sync.WaitGroup
+	writers.Add(2)
+	go func() {
+		defer writers.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			added, err := s.addProducts(testProduct(t, fmt.Sprintf("Beans %d", i), 3000, 1))
+			if err != nil {
+				t.Errorf("addProducts error: %v", err)
+				return
+			}
+			if _, err := s.deleteProducts(added...); err != nil {
+				t.Errorf("deleteProducts error: %v", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer writers.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			err := s.updateProduct(IDs[0], func(p *product) error {
+				p.description = fmt.Sprintf("Rice, batch %d.", i)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("updateProduct error: %v", err)
+				return
+			}
+		}
+	}()
+
+	var sellers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		sellers.Add(1)
+		go func() {
+			defer sellers.Done()
+			for j := 0; j < 100; j++ {
+				// Underpaid orders fail validation, and the rest are sold.
+				amountPaid := Money(5000)
+				if j%2 == 0 {
+					amountPaid = 100
+				}
+				_, err := s.sellProduct(testOrder(buyer, amountPaid, orderLine{product: &product{id: IDs[0]}, quantity: 1}))
+				if (err != nil) != (j%2 == 0) {
+					t.Errorf("sellProduct paying %s error: %v", amountPaid, err)
+				}
+			}
+		}()
+	}
+	sellers.Wait()
+	close(done)
+	writers.Wait()
+
+	if p := s.product(IDs[0]); p == nil || p.Quantity() != 800 {
+		t.Fatalf("product after 200 sales is %v, want 800 units left", p)
+	}
+	checkInvariants(t, s)
+}
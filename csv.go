@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// These are the columns of a product CSV file. Images are separated by
+// csvListSeparator, and specifications are separated by csvListSeparator with
+// each written as "title=description|description". Metadata fields are
+// separated by csvListSeparator with each written as "key=value", and tags
+// are separated by csvListSeparator. A separator or csvEscape inside a value
+// of a list is escaped with csvEscape, e.g. "a\;b" is the single value "a;b".
+const (
+	csvColumnID             = "id"
+	csvColumnName           = "name"
+	csvColumnPrice          = "price"
+	csvColumnQuantity       = "quantity"
+	csvColumnType           = "type"
+	csvColumnCategory       = "category"
+	csvColumnDescription    = "description"
+	csvColumnImages         = "images"
+	csvColumnSpecifications = "specifications"
+	csvColumnMake           = "make"
+	csvColumnModel          = "model"
+	csvColumnColor          = "color"
+	csvColumnYear           = "year"
+	csvColumnMetadata       = "metadata"
+	csvColumnCostPrice      = "cost_price"
+	csvColumnTags           = "tags"
+
+	csvListSeparator     = ";"
+	csvSpecSeparator     = "="
+	csvSpecDescSeparator = "|"
+	csvEscape            = `\`
+)
+
+// csvListEscaper escapes the values of the lists in a product CSV file.
+var csvListEscaper = strings.NewReplacer(
+	csvEscape, csvEscape+csvEscape,
+	csvListSeparator, csvEscape+csvListSeparator,
+	csvSpecSeparator, csvEscape+csvSpecSeparator,
+	csvSpecDescSeparator, csvEscape+csvSpecDescSeparator,
+)
+
+// csvRequiredColumns are the columns a product CSV file must have.
+var csvRequiredColumns = []string{
+	csvColumnName, csvColumnPrice, csvColumnQuantity, csvColumnType,
+	csvColumnDescription, csvColumnImages, csvColumnSpecifications,
+}
+
+// csvExportColumns are the columns written by ExportCSV, in order.
+var csvExportColumns = []string{
+	csvColumnID, csvColumnName, csvColumnPrice, csvColumnQuantity, csvColumnType,
+	csvColumnCategory, csvColumnDescription, csvColumnImages, csvColumnSpecifications,
+	csvColumnMake, csvColumnModel, csvColumnColor, csvColumnYear, csvColumnMetadata,
+	csvColumnCostPrice, csvColumnTags,
+}
+
+// ExportCSV writes every available product to w as a CSV row, after a header
+// row. Rows are sorted by product ID, and the output can be imported with
+// ImportCSV. Car columns are left blank for other products. Products outside
+// their availability window are not written.
+func (s *store) ExportCSV(w io.Writer) error {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	now := s.now()
+	products := make([]Product, 0, len(s.products))
+	for _, p := range s.products {
+		if sellable(p, now) {
+			products = append(products, p)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		iID, jID := products[i].ID(), products[j].ID()
+		return bytes.Compare(iID[:], jID[:]) < 0
+	})
+
+	records := make([][]string, 0, len(products)+1)
+	records = append(records, csvExportColumns)
+	for _, p := range products {
+		records = append(records, productToCSV(p))
+	}
+	s.mtx.RUnlock()
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return fmt.Errorf("error writing csv: %w", err)
+	}
+
+	return nil
+}
+
+// productToCSV returns the CSV record of a product, with the fields in the
+// order of csvExportColumns.
+func productToCSV(p Product) []string {
+	product := p.Product()
+
+	specTitles := make([]string, 0, len(product.specifications))
+	for specTitle := range product.specifications {
+		specTitles = append(specTitles, specTitle)
+	}
+	sort.Strings(specTitles)
+
+	specs := make([]string, len(specTitles))
+	for i, specTitle := range specTitles {
+		specs[i] = csvListEscaper.Replace(specTitle) + csvSpecSeparator + joinCSVList(product.specifications[specTitle], csvSpecDescSeparator)
+	}
+
+	metadataKeys := make([]string, 0, len(product.metadata))
+	for key := range product.metadata {
+		metadataKeys = append(metadataKeys, key)
+	}
+	sort.Strings(metadataKeys)
+
+	metadata := make([]string, len(metadataKeys))
+	for i, key := range metadataKeys {
+		metadata[i] = csvListEscaper.Replace(key) + csvSpecSeparator + csvListEscaper.Replace(product.metadata[key])
+	}
+
+	var costPrice string
+	if product.costPrice != 0 {
+		costPrice = product.costPrice.Format()
+	}
+
+	var carMake, carModel, carColor, carYear string
+	if c, ok := p.(*car); ok {
+		carMake, carModel, carColor, carYear = c.make, c.model, c.color, c.year
+	}
+
+	return []string{
+		product.id.String(),
+		product.name,
+		product.price.Format(),
+		strconv.Itoa(product.quantity),
+		product.productType,
+		product.category,
+		product.description,
+		joinCSVList(product.images, csvListSeparator),
+		strings.Join(specs, csvListSeparator),
+		carMake,
+		carModel,
+		carColor,
+		carYear,
+		strings.Join(metadata, csvListSeparator),
+		costPrice,
+		joinCSVList(product.tags, csvListSeparator),
+	}
+}
+
+// joinCSVList escapes values and joins them with sep.
+func joinCSVList(values []string, sep string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = csvListEscaper.Replace(value)
+	}
+	return strings.Join(escaped, sep)
+}
+
+// ImportCSV adds the products in the CSV data read from r to the store and
+// returns their IDs. The first row must be a header naming the columns, which
+// can be in any order. Rows with a make, model, color or year are imported as
+// cars. An id column is ignored, as imported products get new IDs. No product
+// is added if any row is invalid.
+func (s *store) ImportCSV(r io.Reader) ([]productID, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrCSVNoHeader
+		}
+		return nil, fmt.Errorf("error reading csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range csvRequiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing the %q column", ErrCSVNoHeader, name)
+		}
+	}
+
+	var products []Product
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading csv row: %w", err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		p, err := productFromCSV(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if errs := p.Validate(); len(errs) != 0 {
+			return nil, fmt.Errorf("line %d: product is not valid: %w", line, &ValidationError{Errors: errs})
+		}
+
+		products = append(products, p)
+	}
+
+	if len(products) == 0 {
+		return nil, ErrCSVNoProducts
+	}
+
+	return s.addProducts(products...)
+}
+
+// productFromCSV creates a Product from a CSV record. columns maps the column
+// names to their index in the record.
+func productFromCSV(record []string, columns map[string]int) (Product, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	price, err := parseMoney(field(csvColumnPrice))
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrCSVInvalidField, csvColumnPrice, err)
+	}
+
+	var costPrice Money
+	if rawCostPrice := field(csvColumnCostPrice); rawCostPrice != "" {
+		if costPrice, err = parseMoney(rawCostPrice); err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrCSVInvalidField, csvColumnCostPrice, err)
+		}
+	}
+
+	quantity, err := strconv.Atoi(field(csvColumnQuantity))
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: invalid quantity %q", ErrCSVInvalidField, csvColumnQuantity, field(csvColumnQuantity))
+	}
+
+	specifications, err := parseCSVSpecifications(field(csvColumnSpecifications))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := parseCSVMetadata(field(csvColumnMetadata))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &product{
+		name:           field(csvColumnName),
+		price:          price,
+		costPrice:      costPrice,
+		quantity:       quantity,
+		productType:    field(csvColumnType),
+		category:       field(csvColumnCategory),
+		description:    field(csvColumnDescription),
+		images:         splitCSVValues(field(csvColumnImages)),
+		specifications: specifications,
+		metadata:       metadata,
+		tags:           splitCSVValues(field(csvColumnTags)),
+	}
+
+	c := &car{
+		product: p,
+		make:    field(csvColumnMake),
+		model:   field(csvColumnModel),
+		color:   field(csvColumnColor),
+		year:    field(csvColumnYear),
+	}
+	if c.make == "" && c.model == "" && c.color == "" && c.year == "" {
+		return p, nil
+	}
+
+	return c, nil
+}
+
+// splitCSVList splits a list in a CSV field at every sep that is not escaped,
+// and drops empty values. The values are not unescaped, so they can be split
+// further.
+func splitCSVList(field, sep string) []string {
+	var values []string
+	add := func(value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(field); i++ {
+		if strings.HasPrefix(field[i:], csvEscape) {
+			i += len(csvEscape)
+			continue
+		}
+		if strings.HasPrefix(field[i:], sep) {
+			add(field[start:i])
+			start = i + len(sep)
+			i = start - 1
+		}
+	}
+	add(field[start:])
+	return values
+}
+
+// splitCSVValues splits a list of values in a CSV field and unescapes them.
+func splitCSVValues(field string) []string {
+	values := splitCSVList(field, csvListSeparator)
+	for i, value := range values {
+		values[i] = unescapeCSV(value)
+	}
+	return values
+}
+
+// cutCSVEntry cuts an entry of a list in a CSV field around the first
+// csvSpecSeparator that is not escaped. The key is unescaped but the rest is
+// not.
+func cutCSVEntry(entry string) (key, rest string, ok bool) {
+	for i := 0; i < len(entry); i++ {
+		if strings.HasPrefix(entry[i:], csvEscape) {
+			i += len(csvEscape)
+			continue
+		}
+		if strings.HasPrefix(entry[i:], csvSpecSeparator) {
+			return unescapeCSV(strings.TrimSpace(entry[:i])), entry[i+len(csvSpecSeparator):], true
+		}
+	}
+	return "", "", false
+}
+
+// unescapeCSV removes the escapes of a value of a list in a CSV field.
+func unescapeCSV(value string) string {
+	if !strings.Contains(value, csvEscape) {
+		return value
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if strings.HasPrefix(value[i:], csvEscape) {
+			i += len(csvEscape)
+			if i >= len(value) {
+				break
+			}
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
+
+// parseCSVSpecifications parses the specifications in a CSV field.
+func parseCSVSpecifications(field string) (map[string][]string, error) {
+	specifications := make(map[string][]string)
+	for _, spec := range splitCSVList(field, csvListSeparator) {
+		specTitle, specInfo, ok := cutCSVEntry(spec)
+		if !ok || specTitle == "" {
+			return nil, fmt.Errorf("%w %s: invalid specification %q, expected title%sdescription", ErrCSVInvalidField, csvColumnSpecifications, spec, csvSpecSeparator)
+		}
+
+		for _, specDesc := range splitCSVList(specInfo, csvSpecDescSeparator) {
+			specifications[specTitle] = append(specifications[specTitle], unescapeCSV(specDesc))
+		}
+	}
+	return specifications, nil
+}
+
+// parseCSVMetadata parses the metadata fields in a CSV field.
+func parseCSVMetadata(field string) (map[string]string, error) {
+	var metadata map[string]string
+	for _, entry := range splitCSVList(field, csvListSeparator) {
+		key, value, ok := cutCSVEntry(entry)
+		value = unescapeCSV(strings.TrimSpace(value))
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w %s: invalid metadata %q, expected key%svalue", ErrCSVInvalidField, csvColumnMetadata, entry, csvSpecSeparator)
+		}
+
+		if value == "" {
+			continue
+		}
+
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
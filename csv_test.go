@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	s, _ := testStore(t)
+	p := testProduct(t, `Rice, "long grain"`, 1000, 3,
+		WithDescription("Two lines,\nwith a comma."),
+		WithImages("https://example.com/a;b.png", `https://example.com/c\d.png`),
+		WithSpecifications(map[string][]string{"size=weight": {"5kg|10kg", "a;b"}}),
+		WithTags("grain;rice", "food"),
+	)
+	p.SetMetadata("origin=farm", "Kano; Nigeria")
+	c, err := newCar("Ford Ecosport", "car", WithPrice(5000), WithQuantity(1), WithDescription("A car."),
+		WithImages("https://example.com/car.png"), WithSpecifications(map[string][]string{"engine": {"1.5L"}}),
+		WithMake("Ford"), WithModel("Ecosport"), WithColor("Blue, dark"), WithYear("2018"))
+	if err != nil {
+		t.Fatalf("newCar error: %v", err)
+	}
+	mustAddProducts(t, s, p, c)
+
+	var buf bytes.Buffer
+	if err := s.ExportCSV(&buf); err != nil {
+		t.Fatalf("ExportCSV error: %v", err)
+	}
+
+	imported := newStore("", CurrencyNGN)
+	IDs, err := imported.ImportCSV(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportCSV error: %v:\n%s", err, buf.String())
+	}
+	if len(IDs) != 2 {
+		t.Fatalf("expected 2 imported products, got %d", len(IDs))
+	}
+
+	for _, ID := range IDs {
+		got := imported.product(ID)
+		var want Product = p
+		if _, ok := got.(*car); ok {
+			want = c
+		}
+
+		if got.DisplayName() != want.DisplayName() || got.Product().description != want.Product().description {
+			t.Errorf("imported %q, want %q", got.DisplayName(), want.DisplayName())
+		}
+		for name, fields := range map[string][2]interface{}{
+			"images":         {got.Images(), want.Images()},
+			"specifications": {got.Product().specifications, want.Product().specifications},
+			"metadata":       {got.Product().Metadata(), want.Product().Metadata()},
+			"tags":           {got.Product().Tags(), want.Product().Tags()},
+		} {
+			if !reflect.DeepEqual(fields[0], fields[1]) {
+				t.Errorf("imported %s of %q are %v, want %v", name, want.DisplayName(), fields[0], fields[1])
+			}
+		}
+	}
+
+	cars := imported.carsByMake("Ford")
+	if len(cars) != 1 || cars[0].color != "Blue, dark" || cars[0].year != "2018" {
+		t.Fatalf("car fields were not imported: %+v", cars)
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	header := "name,price,quantity,type,description,images,specifications\n"
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{name: "empty", data: "", want: ErrCSVNoHeader},
+		{name: "missing column", data: "name,price\n", want: ErrCSVNoHeader},
+		{name: "no rows", data: header, want: ErrCSVNoProducts},
+		{name: "invalid price", data: header + "Rice,ten,1,test,d,https://example.com/a.png,a=b\n", want: ErrCSVInvalidField},
+		{name: "invalid quantity", data: header + "Rice,10,one,test,d,https://example.com/a.png,a=b\n", want: ErrCSVInvalidField},
+		{name: "invalid specification", data: header + "Rice,10,1,test,d,https://example.com/a.png,ab\n", want: ErrCSVInvalidField},
+		{name: "invalid product", data: header + "Rice,10,1,test,d,/a.png,a=b\n", want: ErrInvalidProduct},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, _ := testStore(t)
+			if _, err := s.ImportCSV(strings.NewReader(test.data)); !errors.Is(err, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, err)
+			}
+		})
+	}
+}
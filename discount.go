@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DiscountKind is the way a discount reduces the cost of an order.
+type DiscountKind int
+
+// These are the supported discount kinds.
+const (
+	// DiscountPercentage reduces the cost of an order by a percentage.
+	DiscountPercentage DiscountKind = iota
+	// DiscountFixed reduces the cost of an order by a fixed amount.
+	DiscountFixed
+)
+
+// Discount is a promotion that reduces the cost of an order when its code is
+// used at checkout.
+type Discount struct {
+	Kind DiscountKind `json:"kind"`
+	// BasisPoints is the percentage off for percentage discounts in
+	// hundredths of a percent, e.g. 1000 for 10%.
+	BasisPoints int64 `json:"basisPoints,omitempty"`
+	// Amount is the amount off for fixed discounts.
+	Amount Money `json:"amount,omitempty"`
+	// ExpiresAt is when the discount can no longer be used. A nil ExpiresAt
+	// means the discount never expires.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// validate checks that the discount reduces the cost of an order by a valid
+// amount.
+func (d Discount) validate() error {
+	switch d.Kind {
+	case DiscountPercentage:
+		if d.BasisPoints <= 0 || d.BasisPoints > basisPointsPerWhole {
+			return fmt.Errorf("%w: percentage discount must be between 0 and 100 percent", ErrInvalidDiscount)
+		}
+	case DiscountFixed:
+		if d.Amount <= 0 {
+			return fmt.Errorf("%w: fixed discount amount must be positive", ErrInvalidDiscount)
+		}
+	default:
+		return fmt.Errorf("%w: unknown discount kind %d", ErrInvalidDiscount, int(d.Kind))
+	}
+	return nil
+}
+
+// expired checks if the discount has expired at the specified time.
+func (d Discount) expired(at time.Time) bool {
+	return d.ExpiresAt != nil && !at.Before(*d.ExpiresAt)
+}
+
+// amountOff returns how much the discount takes off the provided subtotal. The
+// discount never exceeds the subtotal.
+func (d Discount) amountOff(subtotal Money) Money {
+	var off Money
+	switch d.Kind {
+	case DiscountPercentage:
+		off = subtotal.Percent(d.BasisPoints)
+	case DiscountFixed:
+		off = d.Amount
+	}
+
+	if off > subtotal {
+		return subtotal
+	}
+	return off
+}
+
+// normalizeDiscountCode returns the form discount codes are stored in.
+// Discount codes are not case sensitive.
+func normalizeDiscountCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// addDiscount adds a discount that can be used at checkout with the specified
+// code. An existing discount with the same code is replaced.
+func (s *store) addDiscount(code string, discount Discount) error {
+	code = normalizeDiscountCode(code)
+	if code == "" {
+		return fmt.Errorf("%w: provide a discount code", ErrInvalidDiscount)
+	}
+
+	if err := discount.validate(); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	s.discounts[code] = discount
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// discount returns the usable discount with the specified code.
+func (s *store) discount(code string) (Discount, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.discountLocked(code, s.now())
+}
+
+// discountLocked returns the discount with the specified code if it is usable
+// at the specified time. The lock must be held.
+func (s *store) discountLocked(code string, now time.Time) (Discount, error) {
+	discount, ok := s.discounts[normalizeDiscountCode(code)]
+	if !ok {
+		return Discount{}, fmt.Errorf("%w: unknown discount code %q", ErrInvalidDiscount, code)
+	}
+
+	if discount.expired(now) {
+		return Discount{}, fmt.Errorf("%w: discount code %q has expired", ErrInvalidDiscount, code)
+	}
+
+	return discount, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DuplicatePolicy is what addProducts does with a product that has the same
+// signature as a product already in the store or earlier in the same call.
+type DuplicatePolicy int
+
+// These are the supported duplicate policies.
+const (
+	// DuplicatesAllowed adds duplicates as separate products. It is the
+	// policy of a new store.
+	DuplicatesAllowed DuplicatePolicy = iota
+	// DuplicatesRejected fails the call to addProducts with
+	// ErrDuplicateProduct.
+	DuplicatesRejected
+	// DuplicatesMerged adds the units of a duplicate to the product it
+	// duplicates, which keeps its price and other fields, and returns the
+	// ID of that product.
+	DuplicatesMerged
+)
+
+// ProductSignature returns the key that identifies duplicate products. Two
+// products are duplicates if they have the same signature.
+type ProductSignature func(Product) string
+
+// defaultProductSignature returns the name and type of a product, and the
+// make, model and year of a car, ignoring case.
+func defaultProductSignature(p Product) string {
+	fields := []string{p.DisplayName(), p.Type()}
+	if c, ok := p.(*car); ok {
+		fields = append(fields, c.make, c.model, c.year)
+	}
+	return strings.ToLower(strings.Join(fields, "\x00"))
+}
+
+// setDuplicatePolicy sets what addProducts does with duplicate products, and
+// the signature used to detect them. A nil signature uses the name and type of
+// products, and the make, model and year of cars.
+func (s *store) setDuplicatePolicy(policy DuplicatePolicy, signature ProductSignature) error {
+	switch policy {
+	case DuplicatesAllowed, DuplicatesRejected, DuplicatesMerged:
+	default:
+		return fmt.Errorf("%w: unknown duplicate policy %d", ErrInvalidArgument, int(policy))
+	}
+
+	if signature == nil {
+		signature = defaultProductSignature
+	}
+
+	s.mtx.Lock()
+	s.duplicatePolicy = policy
+	s.productSignature = signature
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// duplicatesLocked returns the products in the store, or earlier in products,
+// that each of products duplicates, keyed by index. It returns an error if the
+// store rejects duplicates and there is one. The lock must be held.
+func (s *store) duplicatesLocked(products []Product) (map[int]Product, error) {
+	if s.duplicatePolicy == DuplicatesAllowed {
+		return nil, nil
+	}
+
+	originals := make(map[string]Product, len(s.products)+len(products))
+	for _, p := range s.products {
+		originals[s.productSignature(p)] = p
+	}
+
+	duplicates := make(map[int]Product)
+	for i, p := range products {
+		signature := s.productSignature(p)
+		original, ok := originals[signature]
+		if !ok {
+			originals[signature] = p
+			continue
+		}
+
+		if s.duplicatePolicy == DuplicatesRejected {
+			return nil, fmt.Errorf("%w: product %q at index %d is already in the store", ErrDuplicateProduct, p.DisplayName(), i)
+		}
+		duplicates[i] = original
+	}
+
+	return duplicates, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// testCar returns a valid car with the specified make, model and year.
+func testCar(t *testing.T, carMake, model, year string, quantity int) *car {
+	t.Helper()
+	c, err := newCar(carMake+" "+model, "car",
+		WithPrice(1_000_000), WithQuantity(quantity), WithDescription("A car for testing."),
+		WithImages("https://example.com/car.png"),
+		WithSpecifications(map[string][]string{"engine": {"1.5L"}}),
+		WithMake(carMake), WithModel(model), WithColor("Blue"), WithYear(year))
+	if err != nil {
+		t.Fatalf("newCar error: %v", err)
+	}
+	return c
+}
+
+func TestDuplicatePolicies(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		s, _ := testStore(t)
+		first := mustAddProducts(t, s, testCar(t, "Ford", "Ecosport", "2020", 1))
+		second := mustAddProducts(t, s, testCar(t, "Ford", "Ecosport", "2020", 1))
+		if products, _ := s.availableProducts(""); first[0] == second[0] || len(products) != 2 {
+			t.Fatalf("duplicates were not added as separate products")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		s, _ := testStore(t)
+		if err := s.setDuplicatePolicy(DuplicatesRejected, nil); err != nil {
+			t.Fatalf("setDuplicatePolicy error: %v", err)
+		}
+		mustAddProducts(t, s, testCar(t, "Ford", "Ecosport", "2020", 1))
+
+		if _, err := s.addProducts(testCar(t, "FORD", "ecosport", "2020", 1)); !errors.Is(err, ErrDuplicateProduct) {
+			t.Fatalf("addProducts error = %v, want ErrDuplicateProduct", err)
+		}
+		if _, err := s.addProducts(testProduct(t, "Rice", 1000, 1), testProduct(t, "rice", 1000, 1)); !errors.Is(err, ErrDuplicateProduct) {
+			t.Fatalf("addProducts error = %v, want ErrDuplicateProduct", err)
+		}
+		if products, _ := s.availableProducts(""); len(products) != 1 {
+			t.Fatalf("store has %d products after rejected duplicates, want 1", len(products))
+		}
+
+		// A car of another year is not a duplicate.
+		mustAddProducts(t, s, testCar(t, "Ford", "Ecosport", "2021", 1))
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		s, _ := testStore(t)
+		if err := s.setDuplicatePolicy(DuplicatesMerged, nil); err != nil {
+			t.Fatalf("setDuplicatePolicy error: %v", err)
+		}
+		first := mustAddProducts(t, s, testCar(t, "Ford", "Ecosport", "2020", 1))
+		second := mustAddProducts(t, s, testCar(t, "Ford", "Ecosport", "2020", 2), testCar(t, "Ford", "Ecosport", "2020", 3))
+		if second[0] != first[0] || second[1] != first[0] {
+			t.Fatalf("merged duplicates have IDs %s and %s, want %s", second[0].String(), second[1].String(), first[0].String())
+		}
+		if products, _ := s.availableProducts(""); len(products) != 1 || products[0].Quantity() != 6 {
+			t.Fatalf("store has %d products after merging duplicates, want 1 with 6 units", len(products))
+		}
+		checkInvariants(t, s)
+	})
+
+	t.Run("custom signature", func(t *testing.T) {
+		s, _ := testStore(t)
+		byMake := func(p Product) string {
+			if c, ok := p.(*car); ok {
+				return c.make
+			}
+			return p.DisplayName()
+		}
+		if err := s.setDuplicatePolicy(DuplicatesRejected, byMake); err != nil {
+			t.Fatalf("setDuplicatePolicy error: %v", err)
+		}
+		mustAddProducts(t, s, testCar(t, "Ford", "Ecosport", "2020", 1))
+		if _, err := s.addProducts(testCar(t, "Ford", "Focus", "2018", 1)); !errors.Is(err, ErrDuplicateProduct) {
+			t.Fatalf("addProducts error = %v, want ErrDuplicateProduct", err)
+		}
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		s, _ := testStore(t)
+		if err := s.setDuplicatePolicy(DuplicatePolicy(-1), nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("setDuplicatePolicy error = %v, want ErrInvalidArgument", err)
+		}
+	})
+}
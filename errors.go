@@ -0,0 +1,71 @@
+package main
+
+import "errors"
+
+// These are the errors returned by the store to describe why an operation
+// failed. They are wrapped with the details of the failure, so use errors.Is
+// to check for them.
+var (
+	// ErrInvalidArgument is returned when a method is called with an
+	// argument it does not accept, such as a negative limit or duration.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrNoProducts is returned when a method that needs one or more
+	// products is called without any.
+	ErrNoProducts = errors.New("provide one or more products")
+	// ErrNoProductIDs is returned when a method that needs one or more
+	// product IDs is called without any.
+	ErrNoProductIDs = errors.New("provide one or more product IDs")
+	// ErrInvalidProduct is returned when a product is not valid or cannot
+	// be added to or updated in the store. A *ValidationError listing the
+	// failed constraints also matches ErrInvalidProduct.
+	ErrInvalidProduct = errors.New("invalid product")
+	// ErrProductUnavailable is returned when a product is sold outside
+	// its availability window.
+	ErrProductUnavailable = errors.New("product is not available")
+	// ErrUnknownProductType is returned when a product is added to a store
+	// that does not sell products of its type.
+	ErrUnknownProductType = errors.New("unknown product type")
+	// ErrProductNotFound is returned when a product is not in the store.
+	ErrProductNotFound = errors.New("product not found")
+	// ErrOutOfStock is returned when fewer units of a product are available
+	// than were ordered or reserved.
+	ErrOutOfStock = errors.New("not enough units in stock")
+	// ErrInvalidCustomer is returned when a customer is not valid.
+	ErrInvalidCustomer = errors.New("invalid customer")
+	// ErrInvalidOrder is returned when an order is incomplete or cannot be
+	// processed as given.
+	ErrInvalidOrder = errors.New("invalid order")
+	// ErrInsufficientPayment is returned when the amount paid for an order
+	// is less than its cost.
+	ErrInsufficientPayment = errors.New("order amount paid is not enough")
+	// ErrBelowMinimumOrder is returned when the total of an order is less
+	// than the store's minimum order amount.
+	ErrBelowMinimumOrder = errors.New("order total is below the minimum order amount")
+	// ErrOrderNotFound is returned when an order has not been processed by
+	// the store.
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrInvalidStatusChange is returned when an order cannot be moved to
+	// the requested status, such as cancelling a delivered order.
+	ErrInvalidStatusChange = errors.New("invalid order status change")
+	// ErrReservationNotFound is returned when a reservation does not exist
+	// or has expired.
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrInvalidDiscount is returned when a discount code is unknown or has
+	// expired, or a discount is not valid.
+	ErrInvalidDiscount = errors.New("invalid discount")
+	// ErrDuplicateProduct is returned when a product is added to a store
+	// that rejects duplicates and it duplicates another product.
+	ErrDuplicateProduct = errors.New("duplicate product")
+	// ErrIDGeneration is returned when a unique ID cannot be generated,
+	// including when the ID generator of the store fails.
+	ErrIDGeneration = errors.New("failed to generate a unique ID")
+	// ErrCSVNoHeader is returned when CSV data has no header row, or the
+	// header is missing a required column.
+	ErrCSVNoHeader = errors.New("csv data has no valid header")
+	// ErrCSVNoProducts is returned when CSV data has a header but no
+	// product rows.
+	ErrCSVNoProducts = errors.New("csv data has no products")
+	// ErrCSVInvalidField is returned when a field of a CSV row cannot be
+	// parsed.
+	ErrCSVInvalidField = errors.New("invalid csv field")
+)
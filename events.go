@@ -0,0 +1,88 @@
+package main
+
+import "sync"
+
+// StoreEventKind is the kind of change a StoreEvent describes.
+type StoreEventKind int
+
+// These are the kinds of store events.
+const (
+	// EventProductsAdded is published after products are added to the store.
+	EventProductsAdded StoreEventKind = iota
+	// EventProductsSold is published after an order is processed.
+	EventProductsSold
+	// EventProductsDeleted is published after products are deleted from the
+	// store.
+	EventProductsDeleted
+	// EventLowStock is published when a sale leaves products at or below
+	// the store's low stock threshold.
+	EventLowStock
+	// EventReservationsReleased is published after reserved units are
+	// returned to the store, when a reservation is released, expires or
+	// is only partly bought.
+	EventReservationsReleased
+)
+
+// StoreEvent describes a change to a store.
+type StoreEvent struct {
+	Kind StoreEventKind
+	// ProductIDs are the IDs of the products that were changed.
+	ProductIDs []productID
+	// OrderID is the ID of the processed order for EventProductsSold and
+	// EventLowStock.
+	OrderID orderID
+}
+
+// subscribers keeps track of the functions to call when store events are
+// published.
+type subscribers struct {
+	mtx    sync.RWMutex
+	nextID int
+	fns    map[int]func(StoreEvent)
+}
+
+// subscribe registers fn to be called after every change to the store, and
+// returns a function that unsubscribes fn. fn is called without the store
+// lock held, so it can safely call back into the store.
+func (s *store) subscribe(fn func(StoreEvent)) (unsubscribe func()) {
+	s.subscribers.mtx.Lock()
+	defer s.subscribers.mtx.Unlock()
+
+	if s.subscribers.fns == nil {
+		s.subscribers.fns = make(map[int]func(StoreEvent))
+	}
+
+	ID := s.subscribers.nextID
+	s.subscribers.nextID++
+	s.subscribers.fns[ID] = fn
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.subscribers.mtx.Lock()
+			delete(s.subscribers.fns, ID)
+			s.subscribers.mtx.Unlock()
+		})
+	}
+}
+
+// publish calls all subscribers with event. It is a no-op if event is nil. The
+// store lock must not be held, so changes to the store defer publishing their
+// event before they lock the store: the deferred unlock runs first, and the
+// event is set while the lock is held. Stock watchers are called the same way.
+func (s *store) publish(event *StoreEvent) {
+	if event == nil {
+		return
+	}
+
+	s.subscribers.mtx.RLock()
+	fns := make([]func(StoreEvent), 0, len(s.subscribers.fns))
+	for _, fn := range s.subscribers.fns {
+		fns = append(fns, fn)
+	}
+	s.subscribers.mtx.RUnlock()
+
+	for _, fn := range fns {
+		fn(*event)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// orderExportJSON is the JSON representation of an order exported for
+// accounting. Unlike orderJSON, it includes the customer who placed the order
+// and the totals of the order.
+type orderExportJSON struct {
+	orderJSON
+	Currency Currency      `json:"currency"`
+	Customer *customerJSON `json:"customer,omitempty"`
+	// Subtotal is the cost of the products before discount and tax,
+	// including refunded products, and Total is what the customer was
+	// charged.
+	Subtotal Money `json:"subtotal"`
+	Total    Money `json:"total"`
+}
+
+// exportOrders writes all processed orders to w as a JSON array, from the
+// earliest placed. Each order includes its customer, line items, totals, tax,
+// discount and timestamps. Exported orders cannot be loaded back into a store,
+// use SaveJSON for that.
+func (s *store) exportOrders(w io.Writer) error {
+	s.mtx.RLock()
+	orders := make([]*order, 0, len(s.processedOrders))
+	for _, order := range s.processedOrders {
+		orders = append(orders, order)
+	}
+	sortOrders(orders)
+
+	exports := make([]orderExportJSON, 0, len(orders))
+	for _, o := range orders {
+		oj, err := encodeOrder(o)
+		if err != nil {
+			s.mtx.RUnlock()
+			return err
+		}
+
+		export := orderExportJSON{orderJSON: oj, Currency: s.currency}
+		if c, ok := s.customers[o.customerID]; ok {
+			export.Customer = &customerJSON{
+				ID:    c.id.String(),
+				Name:  c.name,
+				Email: c.email,
+				Phone: c.phone,
+			}
+		}
+
+		for _, lines := range [][]orderLine{o.products, o.refundedProducts} {
+			for _, line := range lines {
+				export.Subtotal = export.Subtotal.Add(line.cost())
+			}
+		}
+		export.Total = export.Subtotal.Sub(o.discountAmount).Add(o.taxAmount)
+
+		exports = append(exports, export)
+	}
+
+	// The encoded orders share maps and slices with the store's products, so
+	// they are marshaled before the lock is released.
+	b, err := json.MarshalIndent(exports, "", "  ")
+	s.mtx.RUnlock()
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent error: %w", err)
+	}
+
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestExportOrders(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 3))
+	if _, err := s.sellProduct(testOrder(buyer, 10000, line(t, s, IDs[0], 2))); err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.exportOrders(&buf); err != nil {
+		t.Fatalf("exportOrders error: %v", err)
+	}
+
+	var exports []orderExportJSON
+	if err := json.Unmarshal(buf.Bytes(), &exports); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	if len(exports) != 1 {
+		t.Fatalf("expected 1 exported order, got %d", len(exports))
+	}
+	if export := exports[0]; export.Total != 10000 || export.Customer == nil || export.Customer.ID != buyer.String() {
+		t.Fatalf("unexpected export %+v", export)
+	}
+}
+
+// TestExportOrdersConcurrentWrites exports orders while the metadata of a
+// product they share with the stock changes. Run with -race.
+func TestExportOrdersConcurrentWrites(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 3))
+	if _, err := s.sellProduct(testOrder(buyer, 5000, line(t, s, IDs[0], 1))); err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2000; i++ {
+			err := s.updateProduct(IDs[0], func(p *product) error {
+				p.SetMetadata("batch", string(rune('a'+i%26)))
+				return nil
+			})
+			if err != nil {
+				t.Errorf("updateProduct error: %v", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			if err := s.exportOrders(&bytes.Buffer{}); err != nil {
+				t.Errorf("exportOrders error: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,95 @@
+package main
+
+// ProductFilter is a predicate that selects products in a query.
+type ProductFilter func(Product) bool
+
+// ByType returns a ProductFilter that selects products of the specified type.
+func ByType(productType string) ProductFilter {
+	return func(p Product) bool {
+		return p.Type() == productType
+	}
+}
+
+// PriceUnder returns a ProductFilter that selects products with a price below
+// the specified price.
+func PriceUnder(price Money) ProductFilter {
+	return func(p Product) bool {
+		return p.Price() < price
+	}
+}
+
+// ByYear returns a ProductFilter that selects cars of the specified year.
+// Other products are never selected.
+func ByYear(year string) ProductFilter {
+	return func(p Product) bool {
+		c, ok := p.(*car)
+		return ok && c.year == year
+	}
+}
+
+// All returns a ProductFilter that selects products that are selected by all of
+// the specified filters.
+func All(filters ...ProductFilter) ProductFilter {
+	return func(p Product) bool {
+		for _, filter := range filters {
+			if !filter(p) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// findByPredicate returns the available products of s that are of type T and
+// selected by pred, e.g.
+//
+//	findByPredicate(s, func(c *car) bool { return c.year == "2018" })
+//
+// Products of other types are skipped. It is a function rather than a store
+// method because methods cannot have type parameters. pred is called with the
+// store read lock held, so it must not call methods of the store.
+func findByPredicate[T Product](s *store, pred func(T) bool) []T {
+	if pred == nil {
+		return nil
+	}
+
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var products []T
+	now := s.now()
+	for _, product := range s.products {
+		if p, ok := product.(T); ok && sellable(product, now) && pred(p) {
+			products = append(products, p)
+		}
+	}
+	return products
+}
+
+// filterProducts returns the available products selected by pred and their
+// total cost. pred is called with the store read lock held, so it must not
+// call methods of the store.
+func (s *store) filterProducts(pred ProductFilter) ([]Product, Money) {
+	if pred == nil {
+		return nil, 0
+	}
+
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var products []Product
+	var totalCost Money
+	now := s.now()
+	for _, product := range s.products {
+		if sellable(product, now) && pred(product) {
+			products = append(products, product)
+			totalCost = totalCost.Add(product.Price().Mul(int64(product.Quantity())))
+		}
+	}
+
+	return products, totalCost
+}
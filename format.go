@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PriceFormatter formats an amount in a currency for display, such as in
+// product details and receipts.
+type PriceFormatter func(amount Money, currency Currency) string
+
+// defaultCurrencySymbols are the symbols of the currencies the default price
+// formatter knows.
+var defaultCurrencySymbols = map[Currency]string{
+	CurrencyNGN: "₦",
+	CurrencyUSD: "$",
+	CurrencyGBP: "£",
+	CurrencyEUR: "€",
+}
+
+// defaultPriceFormatter formats prices like "₦5,000,000.00". It is the price
+// formatter of a new store.
+var defaultPriceFormatter = GroupedPriceFormatter(defaultCurrencySymbols, ",", ".")
+
+// GroupedPriceFormatter returns a PriceFormatter that writes the major units of
+// an amount in groups of three digits separated by groupSeparator, followed by
+// decimalSeparator and two digits of minor units, e.g. "₦5,000,000.00" with
+// "," and ".", or "€5.000.000,00" with "." and ",". The amount is prefixed
+// with the symbol of its currency in symbols, or followed by the currency code
+// if the currency has no symbol.
+func GroupedPriceFormatter(symbols map[Currency]string, groupSeparator, decimalSeparator string) PriceFormatter {
+	// Copy the symbols so the formatter is not changed by changes to the
+	// map.
+	currencySymbols := make(map[Currency]string, len(symbols))
+	for currency, symbol := range symbols {
+		currencySymbols[currency] = symbol
+	}
+
+	return func(amount Money, currency Currency) string {
+		// Format handles the sign and the smallest Money value, so
+		// group the digits it writes.
+		formatted := amount.Format()
+		sign := ""
+		if strings.HasPrefix(formatted, "-") {
+			sign, formatted = "-", formatted[1:]
+		}
+		major, minor, _ := strings.Cut(formatted, ".")
+
+		var sb strings.Builder
+		sb.WriteString(sign)
+		symbol, hasSymbol := currencySymbols[currency]
+		sb.WriteString(symbol)
+		for i, digit := range major {
+			if i != 0 && (len(major)-i)%3 == 0 {
+				sb.WriteString(groupSeparator)
+			}
+			sb.WriteRune(digit)
+		}
+		sb.WriteString(decimalSeparator)
+		sb.WriteString(minor)
+		if !hasSymbol && currency != "" {
+			sb.WriteString(" ")
+			sb.WriteString(string(currency))
+		}
+		return sb.String()
+	}
+}
+
+// setPriceFormatter sets how the store formats prices in product details and
+// receipts.
+func (s *store) setPriceFormatter(format PriceFormatter) error {
+	if format == nil {
+		return fmt.Errorf("%w: provide a price formatter", ErrInvalidArgument)
+	}
+
+	s.mtx.Lock()
+	s.priceFormatter = format
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// displayProduct writes information about a product to w with prices
+// formatted by the store's price formatter.
+func (s *store) displayProduct(w io.Writer, p Product) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	p.DisplayWith(w, s.priceFormatter)
+}
+
+// writeReceipt writes a receipt for the processed order with the specified ID
+// to w, with prices formatted by the store's price formatter.
+func (s *store) writeReceipt(w io.Writer, ID orderID) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	order, ok := s.processedOrders[ID]
+	if !ok {
+		return fmt.Errorf("%w: order with ID %s does not exist", ErrOrderNotFound, ID.String())
+	}
+
+	order.WriteReceiptWith(w, s.priceFormatter)
+	return nil
+}
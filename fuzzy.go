@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// fuzzySearch returns the available products with a display name within
+// maxDistance edits of the query, from the closest match. The query is
+// compared, ignoring case, with the whole name and with every run of as many
+// consecutive words of the name as the query has, so "ecosprot" matches
+// "Ford Ecosport". An edit is inserting, deleting or replacing a character.
+func (s *store) fuzzySearch(query string, maxDistance int) []Product {
+	queryWords := strings.Fields(strings.ToLower(query))
+	if maxDistance < 0 || len(queryWords) == 0 {
+		return nil
+	}
+	q := []rune(strings.Join(queryWords, " "))
+
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	distances := make(map[Product]int)
+	now := s.now()
+	for _, p := range s.products {
+		if !sellable(p, now) {
+			continue
+		}
+		if distance, ok := nameDistance(q, len(queryWords), p.DisplayName(), maxDistance); ok {
+			distances[p] = distance
+		}
+	}
+	s.mtx.RUnlock()
+
+	products := make([]Product, 0, len(distances))
+	for p := range distances {
+		products = append(products, p)
+	}
+	sortProducts(products, SortByName)
+	sort.SliceStable(products, func(i, j int) bool {
+		return distances[products[i]] < distances[products[j]]
+	})
+
+	return products
+}
+
+// nameDistance returns the smallest edit distance between the lower case query
+// q of n words and the name or a run of n consecutive words of the name. ok is
+// false if no distance is within maxDistance.
+func nameDistance(q []rune, n int, name string, maxDistance int) (distance int, ok bool) {
+	words := strings.Fields(strings.ToLower(name))
+	candidates := []string{strings.Join(words, " ")}
+	if n < len(words) {
+		for i := 0; i+n <= len(words); i++ {
+			candidates = append(candidates, strings.Join(words[i:i+n], " "))
+		}
+	}
+
+	distance = maxDistance + 1
+	for _, candidate := range candidates {
+		if d, within := levenshtein(q, []rune(candidate), distance-1); within {
+			distance = d
+		}
+	}
+
+	return distance, distance <= maxDistance
+}
+
+// levenshtein returns the edit distance between a and b if it is at most
+// maxDistance, with ok false otherwise. It gives up as soon as the distance is
+// known to exceed maxDistance.
+func levenshtein(a, b []rune, maxDistance int) (distance int, ok bool) {
+	if maxDistance < 0 {
+		return 0, false
+	}
+
+	// The distance is at least the difference in length.
+	if diff := len(a) - len(b); diff > maxDistance || -diff > maxDistance {
+		return 0, false
+	}
+
+	// prev and curr are the previous and current rows of the distances
+	// between the prefixes of a and b.
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+
+		// Distances never decrease from one row to the next.
+		if rowMin > maxDistance {
+			return 0, false
+		}
+		prev, curr = curr, prev
+	}
+
+	distance = prev[len(b)]
+	return distance, distance <= maxDistance
+}
+
+// min3 returns the smallest of a, b and c.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProduct returns a valid product of type "test" with the specified name,
+// price and quantity.
+func testProduct(t testing.TB, name string, price Money, quantity int, opts ...ProductOption) *product {
+	t.Helper()
+	opts = append([]ProductOption{
+		WithPrice(price),
+		WithQuantity(quantity),
+		WithDescription("A product for testing."),
+		WithImages("https://example.com/product.png"),
+		WithSpecifications(map[string][]string{"size": {"M"}}),
+	}, opts...)
+	p, err := newProduct(name, "test", opts...)
+	if err != nil {
+		t.Fatalf("newProduct error: %v", err)
+	}
+	return p
+}
+
+// testStore returns an empty NGN store with one customer.
+func testStore(t testing.TB) (*store, customerID) {
+	t.Helper()
+	s := newStore("Test Store", CurrencyNGN)
+	c, err := s.addCustomer(&customer{name: "Ada Obi", email: "ada@example.com", phone: "+2348000000000"})
+	if err != nil {
+		t.Fatalf("addCustomer error: %v", err)
+	}
+	return s, c
+}
+
+// mustAddProducts adds products to s and returns their IDs.
+func mustAddProducts(t testing.TB, s *store, products ...Product) []productID {
+	t.Helper()
+	IDs, err := s.addProducts(products...)
+	if err != nil {
+		t.Fatalf("addProducts error: %v", err)
+	}
+	return IDs
+}
+
+// testOrder returns an order by buyer paying amountPaid for lines.
+func testOrder(buyer customerID, amountPaid Money, lines ...orderLine) *order {
+	return &order{
+		customerID:      buyer,
+		amountPaid:      amountPaid,
+		shippingAddress: "1 Marina Road, Lagos",
+		products:        lines,
+	}
+}
+
+// line returns an order line for units of the product with the specified ID
+// in s.
+func line(t testing.TB, s *store, ID productID, units int) orderLine {
+	t.Helper()
+	p := s.product(ID)
+	if p == nil {
+		t.Fatalf("product with ID %s does not exist", ID.String())
+	}
+	return orderLine{product: p, quantity: units}
+}
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	mtx     sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// fakeTicker is the ticker of a fakeClock. It ticks when the clock is
+// advanced past its next tick, and drops ticks that are not received, like a
+// time.Ticker.
+type fakeTicker struct {
+	clock    *fakeClock
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+	stopped  bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	t.stopped = true
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	t := &fakeTicker{clock: c, c: make(chan time.Time, 1), interval: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// advance moves the clock forward by d, ticking the tickers that are due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		for !t.stopped && !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.interval)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// IDGenerator generates the IDs of new products, orders, customers and
+// reservations. A store retries if a generated ID is zero or already in use.
+type IDGenerator interface {
+	// NewID fills id with the bytes of a new ID. id is 12 or 16 bytes
+	// long.
+	NewID(id []byte) error
+}
+
+// RandomIDs returns an IDGenerator that reads every byte of an ID from r. It
+// is the ID generator of a new store, with crypto/rand.Reader as r.
+func RandomIDs(r io.Reader) IDGenerator {
+	return randomIDs{r: r}
+}
+
+// randomIDs is the IDGenerator returned by RandomIDs.
+type randomIDs struct {
+	r io.Reader
+}
+
+// NewID implements IDGenerator for randomIDs.
+func (g randomIDs) NewID(id []byte) error {
+	if _, err := io.ReadFull(g.r, id); err != nil {
+		return fmt.Errorf("error reading random bytes: %w", err)
+	}
+	return nil
+}
+
+// TimeOrderedIDs returns an IDGenerator of IDs that sort in the order they were
+// generated, to the millisecond, like ULIDs. The first 6 bytes of an ID are
+// the time now returns in milliseconds since the Unix epoch, and the rest are
+// read from r. Pass the now method of a store so its IDs follow the store
+// clock. If now is nil, the real time is used.
+func TimeOrderedIDs(r io.Reader, now func() time.Time) IDGenerator {
+	if now == nil {
+		now = time.Now
+	}
+	return timeOrderedIDs{r: r, now: now}
+}
+
+// timeOrderedIDs is the IDGenerator returned by TimeOrderedIDs.
+type timeOrderedIDs struct {
+	r   io.Reader
+	now func() time.Time
+}
+
+// timestampSize is the number of bytes of the timestamp of a time ordered ID.
+const timestampSize = 6
+
+// NewID implements IDGenerator for timeOrderedIDs.
+func (g timeOrderedIDs) NewID(id []byte) error {
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(g.now().UnixMilli()))
+	copy(id, timestamp[8-timestampSize:])
+
+	if _, err := io.ReadFull(g.r, id[timestampSize:]); err != nil {
+		return fmt.Errorf("error reading random bytes: %w", err)
+	}
+	return nil
+}
+
+// SequentialIDs returns an IDGenerator of IDs that count up from 1. It is
+// meant for tests and single process deployments, as the count starts over
+// for every generator and is shared by all kinds of IDs.
+func SequentialIDs() IDGenerator {
+	return new(sequentialIDs)
+}
+
+// sequentialIDs is the IDGenerator returned by SequentialIDs.
+type sequentialIDs struct {
+	last atomic.Uint64
+}
+
+// NewID implements IDGenerator for sequentialIDs.
+func (g *sequentialIDs) NewID(id []byte) error {
+	for i := range id {
+		id[i] = 0
+	}
+	binary.BigEndian.PutUint64(id[len(id)-8:], g.last.Add(1))
+	return nil
+}
+
+// setIDGenerator sets the generator of the IDs of new products, orders,
+// customers and reservations.
+func (s *store) setIDGenerator(g IDGenerator) error {
+	if g == nil {
+		return fmt.Errorf("%w: provide an ID generator", ErrInvalidArgument)
+	}
+
+	s.mtx.Lock()
+	s.idGenerator = g
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// setIDGenerator sets the generator of the IDs of new products in the
+// catalog.
+func (c *Catalog) setIDGenerator(g IDGenerator) error {
+	if g == nil {
+		return fmt.Errorf("%w: provide an ID generator", ErrInvalidArgument)
+	}
+
+	c.mtx.Lock()
+	c.idGenerator = g
+	c.mtx.Unlock()
+
+	return nil
+}
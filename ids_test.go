@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeOrderedIDsUseStoreClock(t *testing.T) {
+	s, _ := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	if err := s.setIDGenerator(TimeOrderedIDs(rand.Reader, s.now)); err != nil {
+		t.Fatalf("setIDGenerator error: %v", err)
+	}
+
+	first := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1))[0]
+	clock.advance(time.Millisecond)
+	second := mustAddProducts(t, s, testProduct(t, "Beans", 1000, 1))[0]
+
+	var timestamp [8]byte
+	copy(timestamp[8-timestampSize:], first[:timestampSize])
+	if got, want := int64(binary.BigEndian.Uint64(timestamp[:])), clock.Now().Add(-time.Millisecond).UnixMilli(); got != want {
+		t.Fatalf("expected ID timestamp %d, got %d", want, got)
+	}
+
+	if bytes.Compare(first[:], second[:]) >= 0 {
+		t.Fatalf("ID %s generated before %s does not sort first", first.String(), second.String())
+	}
+}
+
+func TestIDCollisionsAreRetried(t *testing.T) {
+	s, buyer := testStore(t)
+	a, b := bytes.Repeat([]byte{0xa}, 16), bytes.Repeat([]byte{0xb}, 16)
+	o, p := bytes.Repeat([]byte{0x1}, 12), bytes.Repeat([]byte{0x2}, 12)
+
+	// The second product and order are first given the IDs of the first.
+	var source bytes.Buffer
+	for _, ID := range [][]byte{a, a, b, o, o, p} {
+		source.Write(ID)
+	}
+	if err := s.setIDGenerator(RandomIDs(&source)); err != nil {
+		t.Fatalf("setIDGenerator error: %v", err)
+	}
+
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 5), testProduct(t, "Beans", 1000, 5))
+	if !bytes.Equal(IDs[0][:], a) || !bytes.Equal(IDs[1][:], b) {
+		t.Fatalf("product IDs are %s and %s, want the colliding ID to be retried", IDs[0].String(), IDs[1].String())
+	}
+
+	var orderIDs []orderID
+	for i := 0; i < 2; i++ {
+		ID, err := s.sellProduct(testOrder(buyer, 1000, line(t, s, IDs[0], 1)))
+		if err != nil {
+			t.Fatalf("sellProduct error: %v", err)
+		}
+		orderIDs = append(orderIDs, ID)
+	}
+	if !bytes.Equal(orderIDs[0][:], o) || !bytes.Equal(orderIDs[1][:], p) {
+		t.Fatalf("order IDs are %s and %s, want the colliding ID to be retried", orderIDs[0].String(), orderIDs[1].String())
+	}
+
+	// A source that only repeats used IDs gives up without overwriting the
+	// product with the ID.
+	if err := s.setIDGenerator(RandomIDs(bytes.NewReader(bytes.Repeat(a, maxIDGenerationAttempts)))); err != nil {
+		t.Fatalf("setIDGenerator error: %v", err)
+	}
+	if _, err := s.addProducts(testProduct(t, "Yam", 1000, 1)); !errors.Is(err, ErrIDGeneration) {
+		t.Fatalf("addProducts error = %v, want ErrIDGeneration", err)
+	}
+	if p := s.product(IDs[0]); p == nil || p.DisplayName() != "Rice" || p.Quantity() != 3 {
+		t.Fatalf("product with the repeated ID was changed: %v", p)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import "strings"
+
+// productIndex maps a product field value to the IDs of the products in stock
+// with that value.
+type productIndex map[string]map[productID]bool
+
+// add adds the product with the specified ID under key.
+func (idx productIndex) add(key string, ID productID) {
+	if idx[key] == nil {
+		idx[key] = make(map[productID]bool)
+	}
+	idx[key][ID] = true
+}
+
+// remove removes the product with the specified ID from under key.
+func (idx productIndex) remove(key string, ID productID) {
+	delete(idx[key], ID)
+	if len(idx[key]) == 0 {
+		delete(idx, key)
+	}
+}
+
+// categoryKey returns the key of a category in the category index. Categories
+// are not case sensitive.
+func categoryKey(category string) string {
+	return strings.ToLower(category)
+}
+
+// putProductLocked adds p to the products in stock, replacing any product
+// with the same ID, and indexes it. Products must only be added to the store
+// with putProductLocked so the indexes stay consistent. The write lock must
+// be held.
+func (s *store) putProductLocked(p Product) {
+	ID := p.ID()
+	if old, ok := s.products[ID]; ok {
+		s.byType.remove(old.Type(), ID)
+		s.byCategory.remove(categoryKey(old.Product().category), ID)
+	}
+
+	s.products[ID] = p
+	s.invalidateViewLocked(ID)
+	s.byType.add(p.Type(), ID)
+	s.byCategory.add(categoryKey(p.Product().category), ID)
+}
+
+// removeProductLocked removes the product with the specified ID from the
+// products in stock and the indexes. The write lock must be held.
+func (s *store) removeProductLocked(ID productID) {
+	p, ok := s.products[ID]
+	if !ok {
+		return
+	}
+
+	s.byType.remove(p.Type(), ID)
+	s.byCategory.remove(categoryKey(p.Product().category), ID)
+	delete(s.products, ID)
+	s.invalidateViewLocked(ID)
+}
+
+// reindexProductLocked moves the product in stock with the specified ID in the
+// indexes after its type or category were changed from productType and
+// category. The write lock must be held.
+func (s *store) reindexProductLocked(ID productID, productType, category string) {
+	p, ok := s.products[ID]
+	if !ok {
+		return
+	}
+
+	s.byType.remove(productType, ID)
+	s.byCategory.remove(categoryKey(category), ID)
+	s.byType.add(p.Type(), ID)
+	s.byCategory.add(categoryKey(p.Product().category), ID)
+}
+
+// rebuildIndexesLocked indexes all the products in stock again. The write
+// lock must be held.
+func (s *store) rebuildIndexesLocked() {
+	s.resetViewLocked()
+	s.byType = make(productIndex)
+	s.byCategory = make(productIndex)
+	for ID, p := range s.products {
+		s.byType.add(p.Type(), ID)
+		s.byCategory.add(categoryKey(p.Product().category), ID)
+	}
+}
+
+// productsOfTypeLocked returns the products in stock of the specified type, or
+// all the products in stock if no type is specified. The lock must be held.
+func (s *store) productsOfTypeLocked(productType string) []Product {
+	if productType == "" {
+		products := make([]Product, 0, len(s.products))
+		for _, p := range s.products {
+			products = append(products, p)
+		}
+		return products
+	}
+
+	return s.indexedProductsLocked(s.byType[productType])
+}
+
+// productsInCategoryLocked returns the products in stock in the specified
+// category, ignoring case. The lock must be held.
+func (s *store) productsInCategoryLocked(category string) []Product {
+	return s.indexedProductsLocked(s.byCategory[categoryKey(category)])
+}
+
+// indexedProductsLocked returns the products in stock with the specified IDs.
+// The lock must be held.
+func (s *store) indexedProductsLocked(IDs map[productID]bool) []Product {
+	products := make([]Product, 0, len(IDs))
+	for ID := range IDs {
+		products = append(products, s.products[ID])
+	}
+	return products
+}
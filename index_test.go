@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// scanProductsLocked returns the IDs of the products in stock matching keep,
+// scanning every product, for comparison with the indexes. The lock must be
+// held.
+func (s *store) scanProductsLocked(keep func(Product) bool) []productID {
+	var IDs []productID
+	for ID, p := range s.products {
+		if keep(p) {
+			IDs = append(IDs, ID)
+		}
+	}
+	return IDs
+}
+
+// sortedIDs returns the IDs of products, sorted.
+func sortedIDs(products []Product) []productID {
+	var IDs []productID
+	for _, p := range products {
+		IDs = append(IDs, p.ID())
+	}
+	sortProductIDs(IDs)
+	return IDs
+}
+
+// sortProductIDs sorts IDs in place.
+func sortProductIDs(IDs []productID) {
+	sort.Slice(IDs, func(i, j int) bool { return IDs[i].String() < IDs[j].String() })
+}
+
+// checkIndexesMatchScan fails the test if the products of any type or
+// category in the indexes differ from a scan of the products in stock.
+func checkIndexesMatchScan(t *testing.T, s *store, types, categories []string) {
+	t.Helper()
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	for _, productType := range types {
+		want := s.scanProductsLocked(func(p Product) bool { return p.Type() == productType })
+		sortProductIDs(want)
+		if got := sortedIDs(s.productsOfTypeLocked(productType)); !reflect.DeepEqual(got, want) {
+			t.Errorf("type %q index has %d products, scan found %d", productType, len(got), len(want))
+		}
+	}
+	for _, category := range categories {
+		want := s.scanProductsLocked(func(p Product) bool { return strings.EqualFold(p.Product().category, category) })
+		sortProductIDs(want)
+		if got := sortedIDs(s.productsInCategoryLocked(category)); !reflect.DeepEqual(got, want) {
+			t.Errorf("category %q index has %d products, scan found %d", category, len(got), len(want))
+		}
+	}
+}
+
+func TestIndexesMatchScan(t *testing.T) {
+	s, buyer := testStore(t)
+	types, categories := []string{"test", "grain", "legume"}, []string{"", "Food", "food", "Dry Goods"}
+	IDs := mustAddProducts(t, s,
+		testProduct(t, "Rice", 5000, 1, WithCategory("Food")),
+		testProduct(t, "Beans", 3000, 2, WithCategory("food")),
+		testProduct(t, "Garri", 2000, 2),
+		testProduct(t, "Yam", 1000, 2, WithCategory("Dry Goods")))
+	checkIndexesMatchScan(t, s, types, categories)
+
+	steps := []struct {
+		name string
+		step func() error
+	}{
+		{"change type and category", func() error {
+			return s.updateProduct(IDs[1], func(p *product) error {
+				p.productType = "legume"
+				p.category = "Dry Goods"
+				return nil
+			})
+		}},
+		{"sell out", func() error {
+			_, err := s.sellProduct(testOrder(buyer, 5000, orderLine{product: &product{id: IDs[0]}, quantity: 1}))
+			return err
+		}},
+		{"delete", func() error {
+			_, err := s.deleteProducts(IDs[2])
+			return err
+		}},
+		{"restore", func() error {
+			return s.restoreProduct(IDs[2])
+		}},
+	}
+	for _, step := range steps {
+		if err := step.step(); err != nil {
+			t.Fatalf("%s error: %v", step.name, err)
+		}
+		checkIndexesMatchScan(t, s, types, categories)
+		checkInvariants(t, s)
+	}
+}
+
+// BenchmarkProductsInCategory compares finding the products in a category
+// with the category index and by scanning every product in stock.
+func BenchmarkProductsInCategory(b *testing.B) {
+	s, IDs := benchmarkStore(b, 10000)
+	for i, ID := range IDs {
+		s.products[ID].Product().category = fmt.Sprintf("Category %d", i%100)
+	}
+	s.rebuildIndexesLocked()
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.mtx.RLock()
+			s.productsInCategoryLocked("category 7")
+			s.mtx.RUnlock()
+		}
+	})
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.mtx.RLock()
+			s.scanProductsLocked(func(p Product) bool { return strings.EqualFold(p.Product().category, "category 7") })
+			s.mtx.RUnlock()
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import "fmt"
+
+// verifyInvariants checks the consistency of the store and returns an error for
+// every violation found. A consistent store has no errors. Products still in
+// stock can share the product of the order lines that sold some of their
+// units, so that alone is not a violation.
+func (s *store) verifyInvariants() []error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var errs []error
+	for ID, p := range s.products {
+		switch {
+		case ID.IsZero():
+			errs = append(errs, fmt.Errorf("product %q has a zero ID", p.DisplayName()))
+		case p.ID() != ID:
+			errs = append(errs, fmt.Errorf("product with ID %s is stored under ID %s", p.ID().String(), ID.String()))
+		}
+
+		if p.Quantity() <= 0 {
+			errs = append(errs, fmt.Errorf("product with ID %s is in stock with %d units", ID.String(), p.Quantity()))
+		}
+
+		if p.Currency() != s.currency {
+			errs = append(errs, fmt.Errorf("product with ID %s is priced in %s but the store is in %s", ID.String(), p.Currency(), s.currency))
+		}
+
+		if !s.byType[p.Type()][ID] || !s.byCategory[categoryKey(p.Product().category)][ID] {
+			errs = append(errs, fmt.Errorf("product with ID %s is missing from the type or category index", ID.String()))
+		}
+	}
+
+	for _, idx := range []productIndex{s.byType, s.byCategory} {
+		for key, IDs := range idx {
+			for ID := range IDs {
+				if _, ok := s.products[ID]; !ok {
+					errs = append(errs, fmt.Errorf("product with ID %s is indexed under %q but not in stock", ID.String(), key))
+				}
+			}
+		}
+	}
+
+	for ID, p := range s.archived {
+		if p.ID() != ID {
+			errs = append(errs, fmt.Errorf("archived product with ID %s is stored under ID %s", p.ID().String(), ID.String()))
+		}
+
+		if _, ok := s.products[ID]; ok {
+			errs = append(errs, fmt.Errorf("product with ID %s is both in stock and archived", ID.String()))
+		}
+	}
+
+	for ID, o := range s.processedOrders {
+		if ID.IsZero() || o.id != ID {
+			errs = append(errs, fmt.Errorf("order with ID %s is stored under ID %s", o.id.String(), ID.String()))
+		}
+
+		if _, ok := s.customers[o.customerID]; !ok {
+			errs = append(errs, fmt.Errorf("order with ID %s is for unknown customer %s", ID.String(), o.customerID.String()))
+		}
+
+		var subtotal, refunded Money
+		for _, line := range o.products {
+			errs = append(errs, checkOrderLine(ID, line)...)
+			subtotal = subtotal.Add(line.cost())
+		}
+		for _, line := range o.refundedProducts {
+			errs = append(errs, checkOrderLine(ID, line)...)
+			refunded = refunded.Add(line.cost())
+		}
+
+		total := subtotal.Add(refunded).Sub(o.discountAmount).Add(o.taxAmount)
+		if charged := o.amountPaid.Sub(o.changeDue).Add(o.balanceDue); charged != total {
+			errs = append(errs, fmt.Errorf("order with ID %s was charged %s but its products cost %s", ID.String(), charged, total))
+		}
+
+		if paid := o.amountPaid.Sub(o.changeDue); o.refundedAmount < 0 || o.refundedAmount > paid || (len(o.refundedProducts) == 0 && o.refundedAmount != 0) {
+			errs = append(errs, fmt.Errorf("order with ID %s refunded %s of the %s paid for it", ID.String(), o.refundedAmount, paid))
+		}
+	}
+
+	for ID, c := range s.customers {
+		if ID.IsZero() || c.id != ID {
+			errs = append(errs, fmt.Errorf("customer with ID %s is stored under ID %s", c.id.String(), ID.String()))
+		}
+	}
+
+	for ID, r := range s.reservations {
+		if ID.IsZero() || r.id != ID {
+			errs = append(errs, fmt.Errorf("reservation with ID %s is stored under ID %s", r.id.String(), ID.String()))
+		}
+
+		for _, line := range r.lines {
+			if line.quantity < 0 {
+				errs = append(errs, fmt.Errorf("reservation with ID %s holds %d units of product with ID %s", ID.String(), line.quantity, line.product.ID().String()))
+			}
+		}
+	}
+
+	return errs
+}
+
+// checkOrderLine returns an error for every problem with a line of the order
+// with the specified ID.
+func checkOrderLine(ID orderID, line orderLine) []error {
+	if line.product == nil {
+		return []error{fmt.Errorf("order with ID %s has a line without a product", ID.String())}
+	}
+
+	var errs []error
+	if line.product.ID().IsZero() {
+		errs = append(errs, fmt.Errorf("order with ID %s has product %q with a zero ID", ID.String(), line.product.DisplayName()))
+	}
+
+	if line.quantity <= 0 {
+		errs = append(errs, fmt.Errorf("order with ID %s has %d units of product with ID %s", ID.String(), line.quantity, line.product.ID().String()))
+	}
+
+	return errs
+}
@@ -38,56 +38,69 @@ func autoShopSimulation() {
 
 	// newStore creates a store that can sell different products. All product
 	// prices in this store are denominated in the Nigerian Naira.
-	autoShop := newStore("Auto Shop")
-
-	item1 := &car{
-		product: &product{
-			name:        "Ford Ecosport",
-			price:       5000000,
-			productType: productTypeCar,
-			category:    "Used Cars",
-			description: "The EcoSport is easy to drive and spacious inside. The 1.0-litre petrol engine is a popular choice because of its efficiency.",
-			images:      []string{"https://uks-cdn.pinewooddms.com/b04b90f8-2e99-463d-a023-7e3c771fb388/vehicles/1935a96a-3bb8-485e-affc-132707e733c1.jpg?", "https://uks-cdn.pinewooddms.com/b04b90f8-2e99-463d-a023-7e3c771fb388/vehicles/4cb99337-5c1b-4f0e-9bb7-3683f23520de.jpg?"},
-			specifications: map[string][]string{
-				"Key Features": {"Bluetooth", "Climate Control", "Air Conditioning", "Ask for a Test Drive Today", "24 Month Guarantee Available", "2 x Keys with car"},
-				"Engine":       {"Auto", "Petrol"},
-			},
-		},
-		color: "yellow",
-		make:  "Ford",
-		model: "1.5 Zetec 5dr",
-		year:  "2016",
+	autoShop := newStore("Auto Shop", CurrencyNGN, productTypeCar, productTypeCarAccessory)
+
+	// Log products as they are sold.
+	unsubscribe := autoShop.subscribe(func(event StoreEvent) {
+		if event.Kind == EventProductsSold {
+			fmt.Printf("%s sold %d product(s) in order with ID(%s)\n", autoShop.name, len(event.ProductIDs), event.OrderID)
+		}
+	})
+	defer unsubscribe()
+
+	item1, err := newCar("Ford Ecosport", productTypeCar,
+		WithPrice(moneyFromMajor(5000000)),
+		WithQuantity(1),
+		WithCategory("Used Cars"),
+		WithDescription("The EcoSport is easy to drive and spacious inside. The 1.0-litre petrol engine is a popular choice because of its efficiency."),
+		WithImages("https://uks-cdn.pinewooddms.com/b04b90f8-2e99-463d-a023-7e3c771fb388/vehicles/1935a96a-3bb8-485e-affc-132707e733c1.jpg?", "https://uks-cdn.pinewooddms.com/b04b90f8-2e99-463d-a023-7e3c771fb388/vehicles/4cb99337-5c1b-4f0e-9bb7-3683f23520de.jpg?"),
+		WithSpecifications(map[string][]string{
+			"Key Features": {"Bluetooth", "Climate Control", "Air Conditioning", "Ask for a Test Drive Today", "24 Month Guarantee Available", "2 x Keys with car"},
+			"Engine":       {"Auto", "Petrol"},
+		}),
+		WithColor("yellow"),
+		WithMake("Ford"),
+		WithModel("1.5 Zetec 5dr"),
+		WithYear("2016"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	item2 := &car{
-		product: &product{
-			name:        "Honda HR-V SPORT",
-			price:       7000000,
-			productType: productTypeCar,
-			category:    "Used Cars",
-			description: "The Honda HR-V SPORT easy to drive and spacious inside. The automatic engine is a popular choice because of its efficiency.",
-			images:      []string{"https://content.homenetiol.com/698/2163991/1920x1080/8ac0270d04d344b1ad58ae18e01c4c88.jpg", "https://content.homenetiol.com/698/2163991/1920x1080/ae3d1b14b4614451938dd3703a18222a.jpg"},
-			specifications: map[string][]string{
-				"Key Features": {"Bluetooth", "Cruise Control", "4 Doors", "Rear Defroster", "Climate Control", "Air Conditioning", "Ask for a Test Drive Today", "24 Month Guarantee Available", "2 x Keys with car"},
-				"Engine":       {"Auto", "Petrol", "4 Cylinders 1.8L"},
-			},
-		},
-		color: "black",
-		make:  "Honda",
-		model: "4 Cylinders 1.8L",
-		year:  "2018",
+	item2, err := newCar("Honda HR-V SPORT", productTypeCar,
+		WithPrice(moneyFromMajor(7000000)),
+		WithQuantity(1),
+		WithCategory("Used Cars"),
+		WithDescription("The Honda HR-V SPORT easy to drive and spacious inside. The automatic engine is a popular choice because of its efficiency."),
+		WithImages("https://content.homenetiol.com/698/2163991/1920x1080/8ac0270d04d344b1ad58ae18e01c4c88.jpg", "https://content.homenetiol.com/698/2163991/1920x1080/ae3d1b14b4614451938dd3703a18222a.jpg"),
+		WithSpecifications(map[string][]string{
+			"Key Features": {"Bluetooth", "Cruise Control", "4 Doors", "Rear Defroster", "Climate Control", "Air Conditioning", "Ask for a Test Drive Today", "24 Month Guarantee Available", "2 x Keys with car"},
+			"Engine":       {"Auto", "Petrol", "4 Cylinders 1.8L"},
+		}),
+		WithColor("black"),
+		WithMake("Honda"),
+		WithModel("4 Cylinders 1.8L"),
+		WithYear("2018"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	item3 := &product{
-		name:        "Toyota Shadow Logo Led Light (For 4 Doors)",
-		price:       14000,
-		productType: productTypeCarAccessory,
-		category:    "Led Lights",
-		description: "TOYOTA LED HOLOGRAM SAFETY LIGHTS(free batteries included): Stay safe at night when stepping out of your cars in poorly lit areas with our classy, elegant light emitting diode car door lights.",
-		images:      []string{"https://ng.jumia.is/unsafe/fit-in/500x500/filters:fill(white)/product/74/552546/1.jpg?6525"},
-		specifications: map[string][]string{
+	item3, err := newProduct("Toyota Shadow Logo Led Light (For 4 Doors)", productTypeCarAccessory,
+		WithPrice(moneyFromMajor(14000)),
+		WithQuantity(10),
+		WithCategory("Led Lights"),
+		WithDescription("TOYOTA LED HOLOGRAM SAFETY LIGHTS(free batteries included): Stay safe at night when stepping out of your cars in poorly lit areas with our classy, elegant light emitting diode car door lights."),
+		WithImages("https://ng.jumia.is/unsafe/fit-in/500x500/filters:fill(white)/product/74/552546/1.jpg?6525"),
+		WithSpecifications(map[string][]string{
 			"Key Features": {"Toyota LED Hologram Safety Lights, Free batteries included"},
-		},
+		}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
 	// Add different supported products to the store.
@@ -102,21 +115,64 @@ func autoShopSimulation() {
 		fmt.Printf("Successfully added product with ID(%s) to %s\n", id, autoShop.name)
 	}
 
+	// The store keeps its own copies of the products, so use their IDs to
+	// access them.
+	item1ID, item2ID, item3ID := productIDs[0], productIDs[1], productIDs[2]
+
 	// Store Feature 2 and 3.
 	// Retrieve information for all products in the store.
 	allAvailableProducts, totalCost := autoShop.availableProducts("")
-	fmt.Printf("%s has %d products available that cost a total of %.2f NGN\n", autoShop.name, len(allAvailableProducts), totalCost)
+	fmt.Printf("%s has %d products available that cost a total of %s %s\n", autoShop.name, len(allAvailableProducts), totalCost, autoShop.currency)
+
+	// List all products in the store from the cheapest.
+	sortedProducts, _ := autoShop.availableProductsSorted("", SortByPriceAsc)
+	for _, p := range sortedProducts {
+		fmt.Printf("%s costs %s %s\n", p.DisplayName(), p.Price(), autoShop.currency)
+	}
 
 	// Retrieve information for a specific product kind in the store.
 	allAvailableProducts, totalCost = autoShop.availableProducts(productTypeCar)
-	fmt.Printf("%s has %d %s's available that cost a total of %.2f NGN\n", autoShop.name, len(allAvailableProducts), productTypeCar, totalCost)
+	fmt.Printf("%s has %d %s's available that cost a total of %s %s\n", autoShop.name, len(allAvailableProducts), productTypeCar, totalCost, autoShop.currency)
+
+	// Retrieve information for products within a price range in the store.
+	carsInRange, totalCost := autoShop.availableProductsInPriceRange(productTypeCar, moneyFromMajor(4000000), moneyFromMajor(8000000))
+	fmt.Printf("%s has %d %s's between 4000000 and 8000000 %s that cost a total of %s %s\n", autoShop.name, len(carsInRange), productTypeCar, autoShop.currency, totalCost, autoShop.currency)
+
+	// Search for products in the store.
+	searchResults := autoShop.searchProducts("bluetooth", true, false)
+	fmt.Printf("%s has %d products matching %q\n", autoShop.name, len(searchResults), "bluetooth")
+
+	// Adjust the price of a product in the store.
+	err = autoShop.updateProduct(item2ID, func(p *product) error {
+		p.price = moneyFromMajor(6500000)
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	updatedItem := autoShop.product(item2ID)
+	fmt.Printf("Updated the price of %s to %s %s\n", updatedItem.DisplayName(), updatedItem.Price(), autoShop.currency)
+	autoShop.displayProduct(os.Stdout, updatedItem)
+
+	// Register the buyer as a customer of the store.
+	customerID, err := autoShop.addCustomer(&customer{
+		name:  "Philemon",
+		email: "philemon@example.com",
+		phone: "+2348000000000",
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	// Store feature 4.
+	orderedCar, orderedAccessory := autoShop.product(item1ID), autoShop.product(item3ID)
 	order := &order{
-		name:            "Philemon",
-		amountPaid:      item1.price + item3.price,
+		customerID:      customerID,
+		amountPaid:      orderedCar.Price().Add(orderedAccessory.Price().Mul(2)),
 		shippingAddress: "No 21 Alt_School Africa street, Banana Island, Lagos",
-		products:        []Product{item1, item3},
+		products:        []orderLine{{product: orderedCar, quantity: 1}, {product: orderedAccessory, quantity: 2}},
 	}
 
 	orderID, err := autoShop.sellProduct(order)
@@ -125,33 +181,52 @@ func autoShopSimulation() {
 		os.Exit(1)
 	}
 	fmt.Printf("%s has processed order with ID(%s) successfully\n", autoShop.name, orderID)
+	if err := autoShop.writeReceipt(os.Stdout, orderID); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Ship the order.
+	if err := autoShop.updateOrderStatus(orderID, OrderStatusShipped); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s has shipped order with ID(%s)\n", autoShop.name, orderID)
 
 	// Store Feature 5.
 	allSoldProducts, totalCost := autoShop.soldProducts("")
-	fmt.Printf("%s has sold a total of %d products for %.2f NGN\n", autoShop.name, len(allSoldProducts), totalCost)
+	fmt.Printf("%s has sold a total of %d products for %s %s\n", autoShop.name, len(allSoldProducts), totalCost, autoShop.currency)
 
 	// Requirement 3 and 4.
 	allSoldCars, totalCost := autoShop.soldProducts(productTypeCar)
-	fmt.Printf("%s has sold %d %s for %.2f NGN\n", autoShop.name, len(allSoldCars), productTypeCar, totalCost)
+	fmt.Printf("%s has sold %d %s for %s %s\n", autoShop.name, len(allSoldCars), productTypeCar, totalCost, autoShop.currency)
 
 	// Requirement 1 and 2.
 	allAvailableCars, totalCost := autoShop.availableProducts(productTypeCar)
-	fmt.Printf("%s has %d %s available that cost a total of %.2f NGN\n", autoShop.name, len(allAvailableCars), productTypeCar, totalCost)
+	fmt.Printf("%s has %d %s available that cost a total of %s %s\n", autoShop.name, len(allAvailableCars), productTypeCar, totalCost, autoShop.currency)
 
 	// Shop feature 5 and Requirement 5.
-	processedOrders, totalPaid := autoShop.orders()
-	fmt.Printf("%s has processed %d orders totalling %2.f NGN\n", autoShop.name, len(processedOrders), totalPaid)
+	processedOrders, revenue, received := autoShop.orders()
+	fmt.Printf("%s has processed %d orders totalling %s %s and received %s %s\n", autoShop.name, len(processedOrders), revenue, autoShop.currency, received, autoShop.currency)
+
+	customerOrders, revenue := autoShop.ordersByCustomer(customerID)
+	fmt.Printf("%s has placed %d orders totalling %s %s\n", autoShop.customer(customerID).name, len(customerOrders), revenue, autoShop.currency)
+
+	// Retrieve a summary of the store inventory.
+	report := autoShop.inventoryReport()
+	fmt.Printf("%s has %d units in stock worth %s %s and has sold %d units for %s %s\n", autoShop.name, report.AvailableCount, report.AvailableValue, report.Currency, report.SoldCount, report.SoldRevenue, report.Currency)
 
 	// Check that products are in stock.
 	inStock := autoShop.inStock(productTypeCar)
 	fmt.Printf("%s has a %s in stock: %v\n", autoShop.name, productTypeCar, inStock)
+	fmt.Printf("%s has %d %s's in stock\n", autoShop.name, autoShop.inStockCount(productTypeCar), productTypeCar)
 
 	inStock = autoShop.inStock(productTypeCarAccessory)
 	fmt.Printf("%s has a %s in stock: %v\n", autoShop.name, productTypeCarAccessory, inStock)
 
 	// Check product availability.
-	product := autoShop.product(item1.id)
-	fmt.Printf("Sold product with id %s is available: %v\n", item1.id, product != nil)
+	product := autoShop.product(item1ID)
+	fmt.Printf("Sold product with id %s is available: %v\n", item1ID, product != nil)
 
 	// Delete products from store.
 	deleted, err := autoShop.deleteProducts(productIDs...)
@@ -160,4 +235,12 @@ func autoShopSimulation() {
 		os.Exit(1)
 	}
 	fmt.Printf("Deleted %d product(s) from %s\n", deleted, autoShop.name)
+
+	// Check that the store is still consistent.
+	if errs := autoShop.verifyInvariants(); len(errs) != 0 {
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// StoreMetrics are running totals of changes to a store since it was created.
+// Unlike the inventory reports, they never go down, e.g. a cancelled order is
+// still counted as sold.
+type StoreMetrics struct {
+	// ProductsAdded is the number of new products added to the store.
+	// Duplicates merged into existing products are not counted.
+	ProductsAdded uint64
+	// OrdersSold is the number of orders sold and UnitsSold is the number
+	// of units of products in them.
+	OrdersSold uint64
+	UnitsSold  uint64
+	// ProductsDeleted is the number of products deleted from the store.
+	ProductsDeleted uint64
+}
+
+// storeCounters are the counters behind StoreMetrics. They are updated
+// atomically so they can be read without the store lock.
+type storeCounters struct {
+	productsAdded   atomic.Uint64
+	ordersSold      atomic.Uint64
+	unitsSold       atomic.Uint64
+	productsDeleted atomic.Uint64
+}
+
+// metrics returns the running totals of changes to the store.
+func (s *store) metrics() StoreMetrics {
+	return StoreMetrics{
+		ProductsAdded:   s.counters.productsAdded.Load(),
+		OrdersSold:      s.counters.ordersSold.Load(),
+		UnitsSold:       s.counters.unitsSold.Load(),
+		ProductsDeleted: s.counters.productsDeleted.Load(),
+	}
+}
+
+// WritePrometheus writes the store's inventory and lifetime metrics to w in the
+// Prometheus text exposition format. Inventory gauges are labelled by product
+// type, and amounts are in major units of the store currency.
+func (s *store) WritePrometheus(w io.Writer) error {
+	report := s.inventoryReport()
+	metrics := s.metrics()
+
+	productTypes := make([]string, 0, len(report.ByType))
+	for productType := range report.ByType {
+		productTypes = append(productTypes, productType)
+	}
+	sort.Strings(productTypes)
+
+	var sb strings.Builder
+	writeGauge := func(name, help string, value func(tr *TypeReport) string) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, productType := range productTypes {
+			fmt.Fprintf(&sb, "%s{type=\"%s\"} %s\n", name, escapeLabelValue(productType), value(report.ByType[productType]))
+		}
+	}
+	writeCounter := func(name, help string, value uint64) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+
+	writeGauge("gstore_available_units", "Units of products on sale.", func(tr *TypeReport) string {
+		return strconv.Itoa(tr.AvailableCount)
+	})
+	writeGauge("gstore_available_value", "Total price of the units of products on sale.", func(tr *TypeReport) string {
+		return tr.AvailableValue.Format()
+	})
+	writeGauge("gstore_sold_units", "Units of products sold in orders that are not cancelled.", func(tr *TypeReport) string {
+		return strconv.Itoa(tr.SoldCount)
+	})
+	writeGauge("gstore_sold_revenue", "Revenue from products sold in orders that are not cancelled.", func(tr *TypeReport) string {
+		return tr.SoldRevenue.Format()
+	})
+
+	writeCounter("gstore_products_added_total", "Products added to the store.", metrics.ProductsAdded)
+	writeCounter("gstore_orders_sold_total", "Orders sold by the store.", metrics.OrdersSold)
+	writeCounter("gstore_units_sold_total", "Units of products sold by the store.", metrics.UnitsSold)
+	writeCounter("gstore_products_deleted_total", "Products deleted from the store.", metrics.ProductsDeleted)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// escapeLabelValue escapes a Prometheus label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// minorUnitsPerMajor is the number of minor units (e.g. kobo or cents) in a
+// major unit (e.g. naira or dollars) of all supported currencies.
+const minorUnitsPerMajor = 100
+
+// maxPrice is the highest price a product can have.
+const maxPrice = Money(1_000_000_000_000 * minorUnitsPerMajor)
+
+// maxOrderSubtotal is the highest cost of the products in an order, e.g. 1000
+// units at maxPrice. With tax charged at up to 100 percent, the total of an
+// order stays far from overflowing a Money value.
+const maxOrderSubtotal = 1000 * maxPrice
+
+// addCost returns subtotal plus the cost of units at price, or false if the
+// sum would be more than maxOrderSubtotal. subtotal, price and units must not
+// be negative.
+func addCost(subtotal, price Money, units int) (Money, bool) {
+	if subtotal > maxOrderSubtotal || (units > 0 && price > (maxOrderSubtotal-subtotal)/Money(units)) {
+		return subtotal, false
+	}
+	return subtotal.Add(price.Mul(int64(units))), true
+}
+
+// Money is an amount of money in the minor units of a currency. Using integer
+// minor units avoids the rounding errors of floating point arithmetic.
+type Money int64
+
+// moneyFromMajor returns the Money value of an amount in major units.
+func moneyFromMajor(major int64) Money {
+	return Money(major * minorUnitsPerMajor)
+}
+
+// parseMoney parses a decimal string in major units, such as "5000000" or
+// "14000.50", into a Money value. At most two decimal places are allowed.
+func parseMoney(s string) (Money, error) {
+	str := strings.TrimSpace(s)
+	negative := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(str, "-")
+
+	whole, fraction, hasFraction := strings.Cut(str, ".")
+	if whole == "" || (hasFraction && fraction == "") {
+		return 0, fmt.Errorf("invalid money amount %q", s)
+	}
+
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("money amount %q has more than two decimal places", s)
+	}
+
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	major, err := strconv.ParseUint(whole, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("invalid money amount %q", s)
+	}
+
+	minor, err := strconv.ParseUint(fraction, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid money amount %q", s)
+	}
+
+	if major > (math.MaxInt64-minor)/minorUnitsPerMajor {
+		return 0, fmt.Errorf("money amount %q is too large", s)
+	}
+
+	m := Money(major*minorUnitsPerMajor + minor)
+	if negative {
+		m = -m
+	}
+
+	return m, nil
+}
+
+// Add returns the sum of m and o.
+func (m Money) Add(o Money) Money {
+	return m + o
+}
+
+// Sub returns the result of subtracting o from m.
+func (m Money) Sub(o Money) Money {
+	return m - o
+}
+
+// Mul returns m multiplied by n, e.g. the cost of n units of a product. The
+// result must fit in a Money value; use addCost to bound the cost of an order.
+func (m Money) Mul(n int64) Money {
+	return m * Money(n)
+}
+
+// Format returns m as a decimal string in major units with two decimal places,
+// e.g. "5000000.00". The result can be parsed back with parseMoney.
+func (m Money) Format() string {
+	sign := ""
+	minor := int64(m)
+	if minor < 0 {
+		sign = "-"
+	}
+
+	// Use unsigned arithmetic so the smallest Money value can be formatted.
+	abs := uint64(minor)
+	if minor < 0 {
+		abs = uint64(-(minor + 1)) + 1
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, abs/minorUnitsPerMajor, abs%minorUnitsPerMajor)
+}
+
+// String implements fmt.Stringer for Money.
+func (m Money) String() string {
+	return m.Format()
+}
+
+// MarshalText implements encoding.TextMarshaler for Money.
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.Format()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for Money.
+func (m *Money) UnmarshalText(text []byte) error {
+	if m == nil {
+		return errors.New("nil Money")
+	}
+
+	v, err := parseMoney(string(text))
+	if err != nil {
+		return err
+	}
+
+	*m = v
+	return nil
+}
+
+// basisPointsPerWhole is the number of basis points (hundredths of a percent)
+// in 100 percent.
+const basisPointsPerWhole = 10000
+
+// Percent returns the given percentage of m, rounded to the nearest minor unit.
+// The percentage is in basis points, e.g. 750 for 7.5%. The result must fit in
+// a Money value, which it always does for percentages up to 100%.
+func (m Money) Percent(basisPoints int64) Money {
+	// m*basisPoints can overflow an int64 for large amounts.
+	n := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(basisPoints))
+	half := big.NewInt(basisPointsPerWhole / 2)
+	if n.Sign() < 0 {
+		half.Neg(half)
+	}
+	n.Add(n, half)
+	return Money(n.Quo(n, big.NewInt(basisPointsPerWhole)).Int64())
+}
+
+// Prorate returns the share of m that part is of whole, rounded to the nearest
+// minor unit, e.g. the part of an order total paid for some of its products.
+// m and part must not be negative and whole must be positive.
+func (m Money) Prorate(part, whole Money) Money {
+	// m*part can overflow an int64 for large amounts.
+	n := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(part)))
+	d := big.NewInt(int64(whole))
+	n.Add(n.Lsh(n, 1), d)
+	return Money(n.Quo(n, d.Lsh(d, 1)).Int64())
+}
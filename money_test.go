@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMoneyProrate(t *testing.T) {
+	tests := []struct {
+		m, part, whole, want Money
+	}{
+		{m: 3870, part: 1000, whole: 4000, want: 968},
+		{m: 3870, part: 3000, whole: 4000, want: 2903},
+		{m: 100, part: 1, whole: 3, want: 33},
+		{m: 100, part: 0, whole: 3, want: 0},
+		{m: math.MaxInt64 / 2, part: 1 << 40, whole: 1 << 41, want: 1 << 61},
+	}
+
+	for _, test := range tests {
+		if got := test.m.Prorate(test.part, test.whole); got != test.want {
+			t.Errorf("%d.Prorate(%d, %d) = %d, want %d", test.m, test.part, test.whole, got, test.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		m           Money
+		basisPoints int64
+		want        Money
+	}{
+		{m: 3600, basisPoints: 750, want: 270},
+		{m: 5, basisPoints: 1000, want: 1},
+		{m: 4, basisPoints: 1000, want: 0},
+		{m: -5, basisPoints: 1000, want: -1},
+		{m: 125 * maxPrice, basisPoints: 750, want: 125 * maxPrice / 10000 * 750},
+		{m: maxOrderSubtotal, basisPoints: basisPointsPerWhole, want: maxOrderSubtotal},
+		{m: math.MaxInt64, basisPoints: basisPointsPerWhole, want: math.MaxInt64},
+	}
+
+	for _, test := range tests {
+		if got := test.m.Percent(test.basisPoints); got != test.want {
+			t.Errorf("%d.Percent(%d) = %d, want %d", test.m, test.basisPoints, got, test.want)
+		}
+	}
+}
+
+func TestParseMoneyRejectsNonFiniteAmounts(t *testing.T) {
+	for _, s := range []string{"NaN", "nan", "Inf", "+Inf", "-Inf", "Infinity", "1e400", "1.5e3", "92233720368547758.08", ""} {
+		if m, err := parseMoney(s); err == nil {
+			t.Errorf("parseMoney(%q) = %s, want an error", s, m)
+		}
+	}
+
+	var m Money
+	if err := m.UnmarshalText([]byte("NaN")); err == nil {
+		t.Fatalf("UnmarshalText(NaN) = %s, want an error", m)
+	}
+}
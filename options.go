@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProductOption sets a field of a product created with newProduct or newCar.
+type ProductOption func(Product) error
+
+// WithPrice sets the price of a product.
+func WithPrice(price Money) ProductOption {
+	return func(p Product) error {
+		p.Product().price = price
+		return nil
+	}
+}
+
+// WithCostPrice sets what the store paid for a unit of a product.
+func WithCostPrice(costPrice Money) ProductOption {
+	return func(p Product) error {
+		p.Product().costPrice = costPrice
+		return nil
+	}
+}
+
+// WithReorderPolicy sets the quantity at or below which more units of a
+// product should be ordered, and how many.
+func WithReorderPolicy(level, quantity int) ProductOption {
+	return func(p Product) error {
+		product := p.Product()
+		product.reorderLevel = level
+		product.reorderQuantity = quantity
+		return nil
+	}
+}
+
+// WithQuantity sets the number of units of a product in stock.
+func WithQuantity(quantity int) ProductOption {
+	return func(p Product) error {
+		p.Product().quantity = quantity
+		return nil
+	}
+}
+
+// WithDescription sets the description of a product.
+func WithDescription(description string) ProductOption {
+	return func(p Product) error {
+		p.Product().description = description
+		return nil
+	}
+}
+
+// WithImages adds image urls to a product.
+func WithImages(images ...string) ProductOption {
+	return func(p Product) error {
+		product := p.Product()
+		product.images = append(product.images, images...)
+		return nil
+	}
+}
+
+// WithCategory sets the category of a product.
+func WithCategory(category string) ProductOption {
+	return func(p Product) error {
+		p.Product().category = category
+		return nil
+	}
+}
+
+// WithAvailabilityWindow sets when a product can start and stop being sold. A
+// nil time leaves the window open on that side.
+func WithAvailabilityWindow(from, until *time.Time) ProductOption {
+	return func(p Product) error {
+		product := p.Product()
+		product.availableFrom = from
+		product.availableUntil = until
+		return nil
+	}
+}
+
+// WithTags adds tags to a product.
+func WithTags(tags ...string) ProductOption {
+	return func(p Product) error {
+		product := p.Product()
+		product.tags = append(product.tags, tags...)
+		return nil
+	}
+}
+
+// WithSpecifications adds specifications to a product. A specification that
+// the product already has is replaced.
+func WithSpecifications(specifications map[string][]string) ProductOption {
+	return func(p Product) error {
+		product := p.Product()
+		if product.specifications == nil {
+			product.specifications = make(map[string][]string, len(specifications))
+		}
+		for specTitle, specInfo := range specifications {
+			product.specifications[specTitle] = append([]string(nil), specInfo...)
+		}
+		return nil
+	}
+}
+
+// WithParent makes a product a variant of the product with the specified ID.
+func WithParent(parentID productID) ProductOption {
+	return func(p Product) error {
+		p.Product().parentID = parentID
+		return nil
+	}
+}
+
+// WithMake sets the make of a car.
+func WithMake(carMake string) ProductOption {
+	return carOption("make", func(c *car) { c.make = carMake })
+}
+
+// WithModel sets the model of a car.
+func WithModel(model string) ProductOption {
+	return carOption("model", func(c *car) { c.model = model })
+}
+
+// WithColor sets the color of a car.
+func WithColor(color string) ProductOption {
+	return carOption("color", func(c *car) { c.color = color })
+}
+
+// WithYear sets the year of a car.
+func WithYear(year string) ProductOption {
+	return carOption("year", func(c *car) { c.year = year })
+}
+
+// carOption returns a ProductOption that calls set for cars, and returns an
+// error for other products.
+func carOption(field string, set func(*car)) ProductOption {
+	return func(p Product) error {
+		c, ok := p.(*car)
+		if !ok {
+			return fmt.Errorf("%s can only be set for cars", field)
+		}
+		set(c)
+		return nil
+	}
+}
+
+// newProduct creates a product with the specified options. It returns an
+// error if an option fails or the product is not valid.
+func newProduct(name, productType string, opts ...ProductOption) (*product, error) {
+	p := &product{
+		name:        name,
+		productType: productType,
+	}
+
+	if err := applyProductOptions(p, opts); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// newCar creates a car with the specified options. It returns an error if an
+// option fails or the car is not valid.
+func newCar(name, productType string, opts ...ProductOption) (*car, error) {
+	c := &car{
+		product: &product{
+			name:        name,
+			productType: productType,
+		},
+	}
+
+	if err := applyProductOptions(c, opts); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// applyProductOptions applies opts to p and validates the result.
+func applyProductOptions(p Product, opts []ProductOption) error {
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return err
+		}
+	}
+
+	if errs := p.Validate(); len(errs) != 0 {
+		return fmt.Errorf("product %q is not valid: %w", p.DisplayName(), &ValidationError{Errors: errs})
+	}
+
+	return nil
+}
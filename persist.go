@@ -0,0 +1,562 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// These are the kinds of products that can be persisted. They are used to
+// reconstruct the concrete type of a Product when loading a store.
+const (
+	productKindProduct = "product"
+	productKindCar     = "car"
+)
+
+// storeJSON is the on-disk representation of a store.
+type storeJSON struct {
+	Name           string              `json:"name"`
+	Currency       Currency            `json:"currency"`
+	Products       []productJSON       `json:"products"`
+	Archived       []productJSON       `json:"archived,omitempty"`
+	Orders         []orderJSON         `json:"orders"`
+	Customers      []customerJSON      `json:"customers"`
+	Discounts      map[string]Discount `json:"discounts,omitempty"`
+	TaxRate        int64               `json:"taxRate,omitempty"`
+	MinOrderAmount Money               `json:"minOrderAmount,omitempty"`
+}
+
+// customerJSON is the on-disk representation of a customer.
+type customerJSON struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// productJSON is the JSON representation of a Product, used both when saving
+// a store and by the MarshalJSON methods of products. The kind field records
+// the concrete type of the product.
+type productJSON struct {
+	Kind           string              `json:"kind"`
+	ID             string              `json:"id"`
+	Name           string              `json:"name"`
+	Price          Money               `json:"price"`
+	CostPrice      Money               `json:"cost_price,omitempty"`
+	ReorderLevel   int                 `json:"reorder_level,omitempty"`
+	ReorderQty     int                 `json:"reorder_quantity,omitempty"`
+	Currency       Currency            `json:"currency"`
+	Quantity       int                 `json:"quantity"`
+	ProductType    string              `json:"product_type"`
+	Category       string              `json:"category"`
+	Description    string              `json:"description"`
+	Images         []string            `json:"images"`
+	Specifications map[string][]string `json:"specifications"`
+	Metadata       map[string]string   `json:"metadata,omitempty"`
+	Tags           []string            `json:"tags,omitempty"`
+	ParentID       string              `json:"parent_id,omitempty"`
+	LastUpdated    *time.Time          `json:"last_updated,omitempty"`
+	CreatedAt      *time.Time          `json:"created_at,omitempty"`
+	DeletedAt      *time.Time          `json:"deleted_at,omitempty"`
+	AvailableFrom  *time.Time          `json:"available_from,omitempty"`
+	AvailableUntil *time.Time          `json:"available_until,omitempty"`
+	Color          string              `json:"color,omitempty"`
+	Make           string              `json:"make,omitempty"`
+	Model          string              `json:"model,omitempty"`
+	Year           string              `json:"year,omitempty"`
+}
+
+// orderJSON is the JSON representation of an order.
+type orderJSON struct {
+	ID              string          `json:"id"`
+	CustomerID      string          `json:"customerID"`
+	AmountPaid      Money           `json:"amountPaid"`
+	ShippingAddress string          `json:"shippingAddress"`
+	Products        []orderLineJSON `json:"products"`
+	Status          OrderStatus     `json:"status"`
+	// RefundedProducts are products that were refunded from the order.
+	RefundedProducts []orderLineJSON `json:"refundedProducts,omitempty"`
+	RefundedAmount   Money           `json:"refundedAmount,omitempty"`
+	DiscountCode     string          `json:"discountCode,omitempty"`
+	DiscountAmount   Money           `json:"discountAmount,omitempty"`
+	TaxAmount        Money           `json:"taxAmount,omitempty"`
+	PlacedAt         *time.Time      `json:"placedAt,omitempty"`
+	ChangeDue        Money           `json:"changeDue,omitempty"`
+	BalanceDue       Money           `json:"balanceDue,omitempty"`
+	Notes            []orderNoteJSON `json:"notes,omitempty"`
+	PaymentMethod    PaymentMethod   `json:"paymentMethod"`
+}
+
+// orderNoteJSON is the JSON representation of an orderNote.
+type orderNoteJSON struct {
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// orderLineJSON is the on-disk representation of an orderLine.
+type orderLineJSON struct {
+	Product  productJSON `json:"product"`
+	Quantity int         `json:"quantity"`
+	Price    Money       `json:"price,omitempty"`
+}
+
+// SaveJSON writes the store's products, processed orders and customers to the
+// file at path as JSON.
+func (s *store) SaveJSON(path string) error {
+	s.mtx.RLock()
+	data := storeJSON{
+		Name:           s.name,
+		Currency:       s.currency,
+		Products:       make([]productJSON, 0, len(s.products)),
+		Orders:         make([]orderJSON, 0, len(s.processedOrders)),
+		Customers:      make([]customerJSON, 0, len(s.customers)),
+		Discounts:      s.discounts,
+		TaxRate:        s.taxRate,
+		MinOrderAmount: s.minOrderAmount,
+	}
+
+	for _, c := range s.customers {
+		data.Customers = append(data.Customers, customerJSON{
+			ID:    c.id.String(),
+			Name:  c.name,
+			Email: c.email,
+			Phone: c.phone,
+		})
+	}
+
+	stock := make(map[productID]int, len(s.products))
+	for ID, p := range s.products {
+		stock[ID] = p.Quantity()
+	}
+
+	// Reservations are not saved, so reserved units are saved as stock.
+	reserved := make(map[productID]Product)
+	for _, r := range s.reservations {
+		for _, line := range r.lines {
+			stock[line.product.ID()] += line.quantity
+			reserved[line.product.ID()] = line.product
+		}
+	}
+
+	for ID, units := range stock {
+		p, ok := s.products[ID]
+		if !ok {
+			p = reserved[ID]
+		}
+
+		pj, err := encodeProduct(p)
+		if err != nil {
+			s.mtx.RUnlock()
+			return err
+		}
+		pj.Quantity = units
+		data.Products = append(data.Products, pj)
+	}
+
+	for _, p := range s.archived {
+		pj, err := encodeProduct(p)
+		if err != nil {
+			s.mtx.RUnlock()
+			return err
+		}
+		data.Archived = append(data.Archived, pj)
+	}
+
+	for _, o := range s.processedOrders {
+		oj, err := encodeOrder(o)
+		if err != nil {
+			s.mtx.RUnlock()
+			return err
+		}
+		data.Orders = append(data.Orders, oj)
+	}
+
+	// data shares maps and slices with the store, so it is marshaled before
+	// the lock is released.
+	b, err := json.MarshalIndent(data, "", "  ")
+	s.mtx.RUnlock()
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent error: %w", err)
+	}
+
+	return os.WriteFile(path, b, 0600)
+}
+
+// LoadJSON replaces the store's products, processed orders and customers with
+// the ones saved in the file at path by SaveJSON.
+func (s *store) LoadJSON(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var data storeJSON
+	if err := json.Unmarshal(b, &data); err != nil {
+		return fmt.Errorf("json.Unmarshal error: %w", err)
+	}
+
+	products := make(map[productID]Product, len(data.Products))
+	for _, pj := range data.Products {
+		p, err := decodeProduct(pj)
+		if err != nil {
+			return err
+		}
+
+		if p.ID().IsZero() {
+			return fmt.Errorf("product %q has no ID", pj.Name)
+		}
+		products[p.ID()] = p
+	}
+
+	// Order lines share the archived products as well as the ones in stock.
+	archived := make(map[productID]Product, len(data.Archived))
+	orderProducts := make(map[productID]Product, len(products)+len(data.Archived))
+	for ID, p := range products {
+		orderProducts[ID] = p
+	}
+	for _, pj := range data.Archived {
+		p, err := decodeProduct(pj)
+		if err != nil {
+			return err
+		}
+
+		if p.ID().IsZero() {
+			return fmt.Errorf("archived product %q has no ID", pj.Name)
+		}
+		archived[p.ID()] = p
+		orderProducts[p.ID()] = p
+	}
+
+	customers := make(map[customerID]*customer, len(data.Customers))
+	for _, cj := range data.Customers {
+		c := &customer{
+			name:  cj.Name,
+			email: cj.Email,
+			phone: cj.Phone,
+		}
+		if err := decodeID(c.id[:], cj.ID); err != nil {
+			return fmt.Errorf("invalid customer ID %q: %w", cj.ID, err)
+		}
+		customers[c.id] = c
+	}
+
+	discounts := make(map[string]Discount, len(data.Discounts))
+	for code, discount := range data.Discounts {
+		discounts[code] = discount
+	}
+
+	processedOrders := make(map[orderID]*order, len(data.Orders))
+	for _, oj := range data.Orders {
+		o := &order{
+			amountPaid:      oj.AmountPaid,
+			shippingAddress: oj.ShippingAddress,
+			status:          oj.Status,
+			refundedAmount:  oj.RefundedAmount,
+			discountCode:    oj.DiscountCode,
+			discountAmount:  oj.DiscountAmount,
+			taxAmount:       oj.TaxAmount,
+			changeDue:       oj.ChangeDue,
+			balanceDue:      oj.BalanceDue,
+			placedAt:        oj.PlacedAt,
+			paymentMethod:   oj.PaymentMethod,
+		}
+		for _, nj := range oj.Notes {
+			o.notes = append(o.notes, orderNote{author: nj.Author, text: nj.Text, createdAt: nj.CreatedAt})
+		}
+		if o.id, err = parseOrderID(oj.ID); err != nil {
+			return err
+		}
+
+		if err := decodeID(o.customerID[:], oj.CustomerID); err != nil {
+			return fmt.Errorf("invalid customer ID %q: %w", oj.CustomerID, err)
+		}
+
+		if o.products, err = decodeOrderLines(oj.Products, orderProducts); err != nil {
+			return err
+		}
+
+		if o.refundedProducts, err = decodeOrderLines(oj.RefundedProducts, orderProducts); err != nil {
+			return err
+		}
+		processedOrders[o.id] = o
+	}
+
+	s.mtx.Lock()
+	s.name = data.Name
+	s.currency = data.Currency
+	s.products = products
+	s.rebuildIndexesLocked()
+	s.archived = archived
+	s.processedOrders = processedOrders
+	s.customers = customers
+	s.discounts = discounts
+	s.taxRate = data.TaxRate
+	s.minOrderAmount = data.MinOrderAmount
+	s.reservations = make(map[reservationID]*reservation)
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// encodeProduct converts a Product to its on-disk representation.
+func encodeProduct(p Product) (productJSON, error) {
+	var pj productJSON
+	var c *car
+	switch pt := p.(type) {
+	case *product:
+		pj.Kind = productKindProduct
+	case *car:
+		pj.Kind = productKindCar
+		c = pt
+	default:
+		return pj, fmt.Errorf("unsupported product type %T", p)
+	}
+
+	product := p.Product()
+	pj.ID = product.id.String()
+	pj.Name = product.name
+	pj.Price = product.price
+	pj.CostPrice = product.costPrice
+	pj.ReorderLevel = product.reorderLevel
+	pj.ReorderQty = product.reorderQuantity
+	pj.Currency = product.currency
+	pj.Quantity = product.quantity
+	pj.ProductType = product.productType
+	pj.Category = product.category
+	pj.Description = product.description
+	pj.Images = product.images
+	pj.Specifications = product.specifications
+	pj.Metadata = product.metadata
+	pj.Tags = product.tags
+	if !product.parentID.IsZero() {
+		pj.ParentID = product.parentID.String()
+	}
+	pj.LastUpdated = product.lastUpdated
+	pj.CreatedAt = product.createdAt
+	pj.DeletedAt = product.deletedAt
+	pj.AvailableFrom = product.availableFrom
+	pj.AvailableUntil = product.availableUntil
+
+	if c != nil {
+		pj.Color = c.color
+		pj.Make = c.make
+		pj.Model = c.model
+		pj.Year = c.year
+	}
+
+	return pj, nil
+}
+
+// decodeProduct reconstructs a Product from its JSON representation. The ID of
+// the product is left zero if pj has no ID.
+func decodeProduct(pj productJSON) (Product, error) {
+	p := &product{
+		name:            pj.Name,
+		price:           pj.Price,
+		costPrice:       pj.CostPrice,
+		reorderLevel:    pj.ReorderLevel,
+		reorderQuantity: pj.ReorderQty,
+		currency:        pj.Currency,
+		quantity:        pj.Quantity,
+		productType:     pj.ProductType,
+		category:        pj.Category,
+		description:     pj.Description,
+		images:          pj.Images,
+		specifications:  pj.Specifications,
+		metadata:        pj.Metadata,
+		tags:            pj.Tags,
+		lastUpdated:     pj.LastUpdated,
+		createdAt:       pj.CreatedAt,
+		deletedAt:       pj.DeletedAt,
+		availableFrom:   pj.AvailableFrom,
+		availableUntil:  pj.AvailableUntil,
+	}
+	if pj.ID != "" {
+		var err error
+		if p.id, err = parseProductID(pj.ID); err != nil {
+			return nil, err
+		}
+	}
+	if pj.ParentID != "" {
+		if err := decodeID(p.parentID[:], pj.ParentID); err != nil {
+			return nil, fmt.Errorf("invalid parent product ID %q: %w", pj.ParentID, err)
+		}
+	}
+
+	switch pj.Kind {
+	case productKindProduct:
+		return p, nil
+	case productKindCar:
+		return &car{
+			product: p,
+			color:   pj.Color,
+			make:    pj.Make,
+			model:   pj.Model,
+			year:    pj.Year,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown product kind %q", pj.Kind)
+	}
+}
+
+// MarshalJSON implements json.Marshaler for product.
+func (p *product) MarshalJSON() ([]byte, error) {
+	pj, err := encodeProduct(p)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(pj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for product.
+func (p *product) UnmarshalJSON(b []byte) error {
+	decoded, err := unmarshalProduct(b)
+	if err != nil {
+		return err
+	}
+
+	pt, ok := decoded.(*product)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal a %T into a product", decoded)
+	}
+
+	*p = *pt
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler for car.
+func (c *car) MarshalJSON() ([]byte, error) {
+	pj, err := encodeProduct(c)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(pj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for car.
+func (c *car) UnmarshalJSON(b []byte) error {
+	decoded, err := unmarshalProduct(b)
+	if err != nil {
+		return err
+	}
+
+	ct, ok := decoded.(*car)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal a %T into a car", decoded)
+	}
+
+	*c = *ct
+	return nil
+}
+
+// unmarshalProduct decodes a product marshaled with MarshalJSON into a Product
+// of the concrete type named by its kind.
+func unmarshalProduct(b []byte) (Product, error) {
+	var pj productJSON
+	if err := json.Unmarshal(b, &pj); err != nil {
+		return nil, err
+	}
+	return decodeProduct(pj)
+}
+
+// unmarshalProducts decodes a JSON array of marshaled products into Products
+// of the concrete types named by their kinds.
+func unmarshalProducts(b []byte) ([]Product, error) {
+	var pjs []productJSON
+	if err := json.Unmarshal(b, &pjs); err != nil {
+		return nil, err
+	}
+
+	products := make([]Product, 0, len(pjs))
+	for _, pj := range pjs {
+		p, err := decodeProduct(pj)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+// encodeOrder converts an order to its JSON representation.
+func encodeOrder(o *order) (orderJSON, error) {
+	oj := orderJSON{
+		ID:              o.id.String(),
+		CustomerID:      o.customerID.String(),
+		AmountPaid:      o.amountPaid,
+		ShippingAddress: o.shippingAddress,
+		Status:          o.status,
+		RefundedAmount:  o.refundedAmount,
+		DiscountCode:    o.discountCode,
+		DiscountAmount:  o.discountAmount,
+		TaxAmount:       o.taxAmount,
+		ChangeDue:       o.changeDue,
+		BalanceDue:      o.balanceDue,
+		PlacedAt:        o.placedAt,
+		PaymentMethod:   o.paymentMethod,
+	}
+	for _, note := range o.notes {
+		oj.Notes = append(oj.Notes, orderNoteJSON{Author: note.author, Text: note.text, CreatedAt: note.createdAt})
+	}
+
+	var err error
+	if oj.Products, err = encodeOrderLines(o.products); err != nil {
+		return oj, err
+	}
+
+	if oj.RefundedProducts, err = encodeOrderLines(o.refundedProducts); err != nil {
+		return oj, err
+	}
+
+	return oj, nil
+}
+
+// encodeOrderLines converts order lines to their on-disk representation.
+func encodeOrderLines(lines []orderLine) ([]orderLineJSON, error) {
+	var ljs []orderLineJSON
+	for _, line := range lines {
+		pj, err := encodeProduct(line.product)
+		if err != nil {
+			return nil, err
+		}
+		ljs = append(ljs, orderLineJSON{Product: pj, Quantity: line.quantity, Price: line.price})
+	}
+	return ljs, nil
+}
+
+// decodeOrderLines reconstructs order lines from their on-disk representation.
+// Products that are still in stock are shared with the order lines.
+func decodeOrderLines(ljs []orderLineJSON, products map[productID]Product) ([]orderLine, error) {
+	var lines []orderLine
+	for _, lj := range ljs {
+		p, err := decodeProduct(lj.Product)
+		if err != nil {
+			return nil, err
+		}
+
+		if storeProduct, ok := products[p.ID()]; ok {
+			p = storeProduct
+		}
+		lines = append(lines, orderLine{product: p, quantity: lj.Quantity, price: lj.Price})
+	}
+	return lines, nil
+}
+
+// decodeID decodes the hex encoded ID s into dst. s must decode to exactly
+// len(dst) bytes.
+func decodeID(dst []byte, s string) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	if len(b) != len(dst) {
+		return fmt.Errorf("ID must be %d bytes but is %d bytes", len(dst), len(b))
+	}
+
+	copy(dst, b)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSaveJSONRoundTrip(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 3, WithTags("food")))
+	if err := s.addDiscount("SAVE10", Discount{Kind: DiscountPercentage, BasisPoints: 1000}); err != nil {
+		t.Fatalf("addDiscount error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := s.SaveJSON(path); err != nil {
+		t.Fatalf("SaveJSON error: %v", err)
+	}
+
+	loaded := newStore("", CurrencyNGN)
+	if err := loaded.LoadJSON(path); err != nil {
+		t.Fatalf("LoadJSON error: %v", err)
+	}
+
+	p := loaded.product(IDs[0])
+	if p == nil {
+		t.Fatalf("product was not loaded")
+	}
+	if p.DisplayName() != "Rice" || p.Quantity() != 3 || !p.Product().HasTag("food") {
+		t.Fatalf("loaded product %v does not match the saved product", p)
+	}
+	if _, err := loaded.discount("SAVE10"); err != nil {
+		t.Fatalf("discount was not loaded: %v", err)
+	}
+}
+
+// TestSaveJSONConcurrentWrites saves the store while its discounts and
+// product metadata change. Run with -race.
+func TestSaveJSONConcurrentWrites(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 3))
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				code := fmt.Sprintf("CODE%d_%d", i, j)
+				if err := s.addDiscount(code, Discount{Kind: DiscountFixed, Amount: 100}); err != nil {
+					t.Errorf("addDiscount error: %v", err)
+					return
+				}
+				err := s.updateProduct(IDs[0], func(p *product) error {
+					p.SetMetadata(code, "set")
+					return nil
+				})
+				if err != nil {
+					t.Errorf("updateProduct error: %v", err)
+					return
+				}
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			path := filepath.Join(dir, fmt.Sprintf("store%d.json", i))
+			for j := 0; j < 20; j++ {
+				if err := s.SaveJSON(path); err != nil {
+					t.Errorf("SaveJSON error: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
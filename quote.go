@@ -0,0 +1,74 @@
+package main
+
+// Quote is what a set of products would cost if they were sold now.
+type Quote struct {
+	Currency Currency
+	Lines    []QuoteLine
+	// Subtotal is the cost of the products before discount and tax, and
+	// Total is what the buyer would pay.
+	Subtotal       Money
+	DiscountAmount Money
+	TaxAmount      Money
+	Total          Money
+}
+
+// QuoteLine is the cost of the units of a single product in a Quote.
+type QuoteLine struct {
+	ProductID productID
+	Name      string
+	Quantity  int
+	UnitPrice Money
+	Cost      Money
+}
+
+// quote returns what the products with the specified IDs would cost with the
+// discount with the specified code, if any, using the same pricing as
+// sellProduct. A product ID that is repeated is quoted for as many units. The
+// store is not changed, so the prices may change before the products are
+// sold.
+func (s *store) quote(productIDs []productID, discountCode string) (Quote, error) {
+	if len(productIDs) == 0 {
+		return Quote{}, ErrNoProductIDs
+	}
+
+	// Group repeated IDs into a single line, in the order they are first
+	// seen.
+	var lines []orderLine
+	lineIndexByID := make(map[productID]int, len(productIDs))
+	for _, ID := range productIDs {
+		if index, ok := lineIndexByID[ID]; ok {
+			lines[index].quantity++
+			continue
+		}
+		lineIndexByID[ID] = len(lines)
+		lines = append(lines, orderLine{product: &product{id: ID}, quantity: 1})
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	check, err := s.priceLinesLocked(lines, nil, discountCode, s.now())
+	if err != nil {
+		return Quote{}, err
+	}
+
+	quote := Quote{
+		Currency:       s.currency,
+		Lines:          make([]QuoteLine, len(check.lines)),
+		Subtotal:       check.subtotal,
+		DiscountAmount: check.discountAmount,
+		TaxAmount:      check.taxAmount,
+		Total:          check.total,
+	}
+	for i, line := range check.lines {
+		quote.Lines[i] = QuoteLine{
+			ProductID: line.product.ID(),
+			Name:      line.product.DisplayName(),
+			Quantity:  line.quantity,
+			UnitPrice: line.unitPrice(),
+			Cost:      line.cost(),
+		}
+	}
+
+	return quote, nil
+}
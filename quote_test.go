@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuote(t *testing.T) {
+	s, _ := testStore(t)
+	if err := s.setTaxRate(750); err != nil {
+		t.Fatalf("setTaxRate error: %v", err)
+	}
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 2), testProduct(t, "Beans", 3000, 1))
+
+	q, err := s.quote([]productID{IDs[0], IDs[1], IDs[0]}, "")
+	if err != nil {
+		t.Fatalf("quote error: %v", err)
+	}
+	if len(q.Lines) != 2 || q.Lines[0].Quantity != 2 || q.Lines[0].Cost != 2000 {
+		t.Fatalf("unexpected quote lines %+v", q.Lines)
+	}
+	if q.Subtotal != 5000 || q.TaxAmount != 375 || q.Total != 5375 {
+		t.Fatalf("unexpected quote totals %+v", q)
+	}
+
+	if _, err := s.quote([]productID{IDs[1], IDs[1]}, ""); !errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("expected ErrOutOfStock, got %v", err)
+	}
+}
+
+func TestQuoteExpiredReservation(t *testing.T) {
+	s, _ := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1))
+	if _, err := s.reserve(time.Minute, IDs[0]); err != nil {
+		t.Fatalf("reserve error: %v", err)
+	}
+
+	var events int
+	s.subscribe(func(StoreEvent) { events++ })
+
+	clock.advance(time.Minute)
+	q, err := s.quote([]productID{IDs[0]}, "")
+	if err != nil {
+		t.Fatalf("quote error: %v", err)
+	}
+	if q.Total != 1000 {
+		t.Fatalf("expected total of 10.00, got %s", q.Total)
+	}
+	if len(s.reservations) != 1 || events != 0 {
+		t.Fatalf("quote released the expired reservation")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteReceipt writes a receipt for a processed order to w. The totals are
+// computed from the prices the products were sold at, so they match what
+// sellProduct charged.
+func (o *order) WriteReceipt(w io.Writer) {
+	o.WriteReceiptWith(w, defaultPriceFormatter)
+}
+
+// WriteReceiptWith is like WriteReceipt but prices are formatted with format.
+func (o *order) WriteReceiptWith(w io.Writer, format PriceFormatter) {
+	var currency Currency
+	var subtotal Money
+	for _, lines := range [][]orderLine{o.products, o.refundedProducts} {
+		for _, line := range lines {
+			currency = line.product.Currency()
+			subtotal = subtotal.Add(line.cost())
+		}
+	}
+	total := subtotal.Sub(o.discountAmount).Add(o.taxAmount)
+	price := func(amount Money) string {
+		return format(amount, currency)
+	}
+
+	fmt.Fprintln(w, "Order: ", o.id.String())
+	if o.placedAt != nil {
+		fmt.Fprintln(w, "Date: ", o.placedAt.Format(time.RFC1123))
+	}
+	fmt.Fprintln(w, "Ship to: ", o.shippingAddress)
+	fmt.Fprintln(w)
+
+	// Refunded lines are listed once with the other lines, as they still
+	// count towards the total, and marked as refunded.
+	writeLines := func(lines []orderLine, status string) {
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %d x %s @ %s = %s%s\n", line.quantity, line.product.DisplayName(), price(line.unitPrice()), price(line.cost()), status)
+		}
+	}
+	writeLines(o.products, "")
+	writeLines(o.refundedProducts, " (refunded)")
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Subtotal: ", price(subtotal))
+	if o.discountAmount != 0 {
+		fmt.Fprintf(w, "Discount (%s):  %s\n", o.discountCode, price(-o.discountAmount))
+	}
+	if o.taxAmount != 0 {
+		fmt.Fprintln(w, "Tax: ", price(o.taxAmount))
+	}
+	fmt.Fprintln(w, "Total: ", price(total))
+	fmt.Fprintln(w, "Amount paid: ", price(o.amountPaid), "by", o.paymentMethod)
+	fmt.Fprintln(w, "Change due: ", price(o.changeDue))
+	if o.balanceDue != 0 {
+		fmt.Fprintln(w, "Balance due: ", price(o.balanceDue))
+	}
+
+	if len(o.refundedProducts) != 0 {
+		fmt.Fprintln(w, "Amount refunded: ", price(o.refundedAmount))
+	}
+}
+
+// Receipt returns the receipt written by WriteReceipt.
+func (o *order) Receipt() string {
+	var sb strings.Builder
+	o.WriteReceipt(&sb)
+	return sb.String()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReceiptRefundedLines(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1), testProduct(t, "Beans", 3000, 1))
+	o := testOrder(buyer, 5000, line(t, s, IDs[0], 1), line(t, s, IDs[1], 1))
+	ID, err := s.sellProduct(o)
+	if err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+	if _, err := s.refundOrderItems(ID, IDs[0]); err != nil {
+		t.Fatalf("refundOrderItems error: %v", err)
+	}
+
+	receipt := o.Receipt()
+	if n := strings.Count(receipt, "Rice"); n != 1 {
+		t.Fatalf("expected the refunded line once, got %d times in:\n%s", n, receipt)
+	}
+	for _, want := range []string{
+		"1 x Rice @ ₦10.00 = ₦10.00 (refunded)\n",
+		"1 x Beans @ ₦30.00 = ₦30.00\n",
+		"Total:  ₦40.00\n",
+		"Change due:  ₦10.00\n",
+		"Amount refunded:  ₦10.00\n",
+	} {
+		if !strings.Contains(receipt, want) {
+			t.Errorf("receipt does not contain %q:\n%s", want, receipt)
+		}
+	}
+}
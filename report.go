@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+// InventoryReport is a summary of the available and sold products in a store.
+type InventoryReport struct {
+	// Currency is the currency all values in the report are denominated in.
+	Currency Currency
+	// AvailableCount is the number of units of products on sale, in stock
+	// and within their availability window, and AvailableValue is their
+	// total cost.
+	AvailableCount int
+	AvailableValue Money
+	// SoldCount is the number of units of products sold and SoldRevenue is
+	// their total cost.
+	SoldCount   int
+	SoldRevenue Money
+	// ByType is a breakdown of the report by product type.
+	ByType map[string]*TypeReport
+}
+
+// TypeReport is a summary of the available and sold products of a single
+// product type.
+type TypeReport struct {
+	AvailableCount int
+	AvailableValue Money
+	SoldCount      int
+	SoldRevenue    Money
+}
+
+// inventoryReport returns a summary of the available and sold products in the
+// store. Products from cancelled orders are not considered sold.
+func (s *store) inventoryReport() InventoryReport {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	report := InventoryReport{
+		Currency: s.currency,
+		ByType:   make(map[string]*TypeReport),
+	}
+
+	typeReport := func(productType string) *TypeReport {
+		tr, ok := report.ByType[productType]
+		if !ok {
+			tr = new(TypeReport)
+			report.ByType[productType] = tr
+		}
+		return tr
+	}
+
+	now := s.now()
+	for _, p := range s.products {
+		if !sellable(p, now) {
+			continue
+		}
+
+		units := p.Quantity()
+		value := p.Price().Mul(int64(units))
+		report.AvailableCount += units
+		report.AvailableValue = report.AvailableValue.Add(value)
+
+		tr := typeReport(p.Type())
+		tr.AvailableCount += units
+		tr.AvailableValue = tr.AvailableValue.Add(value)
+	}
+
+	for _, order := range s.processedOrders {
+		if order.status == OrderStatusCancelled {
+			continue
+		}
+
+		for _, line := range order.products {
+			cost := line.cost()
+			report.SoldCount += line.quantity
+			report.SoldRevenue = report.SoldRevenue.Add(cost)
+
+			tr := typeReport(line.product.Type())
+			tr.SoldCount += line.quantity
+			tr.SoldRevenue = tr.SoldRevenue.Add(cost)
+		}
+	}
+
+	return report
+}
+
+// ProfitReport is a summary of the profit made on sold products. Products
+// without a cost price are left out of the profit.
+type ProfitReport struct {
+	// Currency is the currency all values in the report are denominated in.
+	Currency Currency
+	// Revenue is the revenue from sold products with a cost price, Cost is
+	// their total cost price and Profit is the difference.
+	Revenue Money
+	Cost    Money
+	Profit  Money
+	// UnknownCostRevenue is the revenue from sold products without a cost
+	// price.
+	UnknownCostRevenue Money
+	// ByProduct is the profit made on each sold product with a cost price,
+	// from the most profitable.
+	ByProduct []ProductProfit
+}
+
+// ProductProfit is the profit made on a single sold product.
+type ProductProfit struct {
+	ProductID productID
+	Name      string
+	UnitsSold int
+	Revenue   Money
+	Cost      Money
+	Profit    Money
+}
+
+// profitReport returns a summary of the profit made on sold products, using
+// the price each unit was sold at and the current cost price of the product.
+// Products from cancelled orders are not considered sold.
+func (s *store) profitReport() ProfitReport {
+	s.mtx.RLock()
+	report := ProfitReport{Currency: s.currency}
+	profitByID := make(map[productID]*ProductProfit)
+	for _, order := range s.processedOrders {
+		if order.status == OrderStatusCancelled {
+			continue
+		}
+
+		for _, line := range order.products {
+			revenue := line.cost()
+			costPrice := line.product.Product().costPrice
+			if costPrice == 0 {
+				report.UnknownCostRevenue = report.UnknownCostRevenue.Add(revenue)
+				continue
+			}
+
+			ID := line.product.ID()
+			profit, ok := profitByID[ID]
+			if !ok {
+				profit = &ProductProfit{ProductID: ID, Name: line.product.DisplayName()}
+				profitByID[ID] = profit
+			}
+			cost := costPrice.Mul(int64(line.quantity))
+			profit.UnitsSold += line.quantity
+			profit.Revenue = profit.Revenue.Add(revenue)
+			profit.Cost = profit.Cost.Add(cost)
+			profit.Profit = profit.Revenue.Sub(profit.Cost)
+		}
+	}
+	s.mtx.RUnlock()
+
+	report.ByProduct = make([]ProductProfit, 0, len(profitByID))
+	for _, profit := range profitByID {
+		report.ByProduct = append(report.ByProduct, *profit)
+		report.Revenue = report.Revenue.Add(profit.Revenue)
+		report.Cost = report.Cost.Add(profit.Cost)
+	}
+	report.Profit = report.Revenue.Sub(report.Cost)
+
+	sort.Slice(report.ByProduct, func(i, j int) bool {
+		a, b := report.ByProduct[i], report.ByProduct[j]
+		if a.Profit != b.Profit {
+			return a.Profit > b.Profit
+		}
+		return bytes.Compare(a.ProductID[:], b.ProductID[:]) < 0
+	})
+
+	return report
+}
+
+// ReorderSuggestion is a product that is at or below its reorder level.
+type ReorderSuggestion struct {
+	ProductID productID
+	Name      string
+	// Quantity is the number of units of the product left in stock.
+	Quantity     int
+	ReorderLevel int
+	// ReorderQuantity is the number of units to order.
+	ReorderQuantity int
+}
+
+// reorderSuggestions returns the products with a reorder policy that are at or
+// below their reorder level, including sold out products, from the lowest
+// quantity. Products outside their availability window are included, as they
+// still have to be restocked.
+func (s *store) reorderSuggestions() []ReorderSuggestion {
+	s.mtx.RLock()
+	products := make([]Product, 0, len(s.products))
+	for _, product := range s.products {
+		products = append(products, product)
+	}
+	products = append(products, s.soldOutProducts()...)
+
+	var suggestions []ReorderSuggestion
+	for _, p := range products {
+		product := p.Product()
+		if product.reorderQuantity == 0 || product.quantity > product.reorderLevel {
+			continue
+		}
+
+		suggestions = append(suggestions, ReorderSuggestion{
+			ProductID:       product.id,
+			Name:            product.name,
+			Quantity:        product.quantity,
+			ReorderLevel:    product.reorderLevel,
+			ReorderQuantity: product.reorderQuantity,
+		})
+	}
+	s.mtx.RUnlock()
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Quantity != b.Quantity {
+			return a.Quantity < b.Quantity
+		}
+		return bytes.Compare(a.ProductID[:], b.ProductID[:]) < 0
+	})
+
+	return suggestions
+}
+
+// PriceStats is a summary of the prices of available products. Averages are
+// rounded to the nearest minor unit.
+type PriceStats struct {
+	// HasData is false if there are no products, in which case the other
+	// fields are zero.
+	HasData bool
+	// Count is the number of products.
+	Count int
+	Min   Money
+	Max   Money
+	// Mean is the average price of the products, and WeightedMean is the
+	// average price of their units in stock.
+	Mean         Money
+	WeightedMean Money
+	// Median is the middle price of the products, or the mean of the two
+	// middle prices if there is an even number of products.
+	Median Money
+}
+
+// priceStats returns a summary of the prices of the available products
+// matching the provided product type. If no product type is specified, the
+// prices of all the available products in the store are summarized.
+func (s *store) priceStats(productType string) PriceStats {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	var prices []Money
+	var sum, unitsValue Money
+	var units int64
+	now := s.now()
+	for _, product := range s.productsOfTypeLocked(productType) {
+		if !sellable(product, now) {
+			continue
+		}
+
+		price := product.Price()
+		prices = append(prices, price)
+		sum = sum.Add(price)
+		unitsValue = unitsValue.Add(price.Mul(int64(product.Quantity())))
+		units += int64(product.Quantity())
+	}
+	s.mtx.RUnlock()
+
+	if len(prices) == 0 {
+		return PriceStats{}
+	}
+
+	sort.Slice(prices, func(i, j int) bool { return prices[i] < prices[j] })
+
+	n := len(prices)
+	median := prices[n/2]
+	if n%2 == 0 {
+		median = roundedMean(prices[n/2-1].Add(prices[n/2]), 2)
+	}
+
+	return PriceStats{
+		HasData:      true,
+		Count:        n,
+		Min:          prices[0],
+		Max:          prices[n-1],
+		Mean:         roundedMean(sum, int64(n)),
+		WeightedMean: roundedMean(unitsValue, units),
+		Median:       median,
+	}
+}
+
+// roundedMean returns total divided by n, rounded to the nearest minor unit.
+// total must not be negative, and n must be positive.
+func roundedMean(total Money, n int64) Money {
+	return (total + Money(n/2)) / Money(n)
+}
+
+// ProductSales is a summary of the sales of a single product.
+type ProductSales struct {
+	ProductID productID
+	Name      string
+	UnitsSold int
+	Revenue   Money
+}
+
+// topSellingProducts returns the sales of the n products with the most units
+// sold, from the best selling. Products with the same number of units sold
+// are ranked by revenue. Products from cancelled orders are not considered
+// sold.
+func (s *store) topSellingProducts(n int) []ProductSales {
+	if n <= 0 {
+		return nil
+	}
+
+	s.mtx.RLock()
+	salesByID := make(map[productID]*ProductSales)
+	for _, order := range s.processedOrders {
+		if order.status == OrderStatusCancelled {
+			continue
+		}
+
+		for _, line := range order.products {
+			ID := line.product.ID()
+			sales, ok := salesByID[ID]
+			if !ok {
+				sales = &ProductSales{ProductID: ID, Name: line.product.DisplayName()}
+				salesByID[ID] = sales
+			}
+			sales.UnitsSold += line.quantity
+			sales.Revenue = sales.Revenue.Add(line.cost())
+		}
+	}
+	s.mtx.RUnlock()
+
+	topSales := make([]ProductSales, 0, len(salesByID))
+	for _, sales := range salesByID {
+		topSales = append(topSales, *sales)
+	}
+
+	sort.Slice(topSales, func(i, j int) bool {
+		a, b := topSales[i], topSales[j]
+		if a.UnitsSold != b.UnitsSold {
+			return a.UnitsSold > b.UnitsSold
+		}
+		if a.Revenue != b.Revenue {
+			return a.Revenue > b.Revenue
+		}
+		return bytes.Compare(a.ProductID[:], b.ProductID[:]) < 0
+	})
+
+	if n < len(topSales) {
+		topSales = topSales[:n]
+	}
+
+	return topSales
+}
+
+// revenueByPaymentMethod returns the revenue from processed orders matching any
+// of the provided statuses grouped by payment method, net of change and
+// refunds. If no status is specified, all processed orders are included, like
+// with orders.
+func (s *store) revenueByPaymentMethod(statuses ...OrderStatus) map[PaymentMethod]Money {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	revenue := make(map[PaymentMethod]Money)
+	for _, order := range s.processedOrders {
+		if len(statuses) != 0 && !hasOrderStatus(statuses, order.status) {
+			continue
+		}
+		revenue[order.paymentMethod] = revenue[order.paymentMethod].Add(order.revenue())
+	}
+
+	return revenue
+}
+
+// revenueByType returns the revenue from sold products grouped by product
+// type. Products from cancelled orders are not considered sold.
+func (s *store) revenueByType() map[string]Money {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	revenue := make(map[string]Money)
+	for _, order := range s.processedOrders {
+		if order.status == OrderStatusCancelled {
+			continue
+		}
+
+		for _, line := range order.products {
+			productType := line.product.Type()
+			revenue[productType] = revenue[productType].Add(line.cost())
+		}
+	}
+
+	return revenue
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// reservationID is the unique ID of a reservation.
+type reservationID [12]byte
+
+var zeroReservationID reservationID
+
+func (ri reservationID) String() string {
+	return hex.EncodeToString(ri[:])
+}
+
+func (ri reservationID) IsZero() bool {
+	return ri == zeroReservationID
+}
+
+// reservation holds units of products for a pending checkout. Reserved units
+// are taken out of stock, so they cannot be sold to anyone but the holder of
+// the reservation until it is released or expires.
+type reservation struct {
+	id        reservationID
+	lines     []orderLine
+	expiresAt time.Time
+}
+
+// units returns the number of units of the product with the specified ID held
+// by the reservation.
+func (r *reservation) units(ID productID) int {
+	if index := lineIndex(r.lines, ID); index != -1 {
+		return r.lines[index].quantity
+	}
+	return 0
+}
+
+// expired checks if the reservation has expired at the specified time.
+func (r *reservation) expired(at time.Time) bool {
+	return !at.Before(r.expiresAt)
+}
+
+// reserve holds one unit of each of the specified products for ttl, and
+// returns the reservation ID. Reserved units are not available to other
+// buyers, and an order must reference the reservation ID to buy them.
+func (s *store) reserve(ttl time.Duration, productIDs ...productID) (reservationID, error) {
+	if ttl <= 0 {
+		return zeroReservationID, fmt.Errorf("%w: reservation duration must be positive", ErrInvalidArgument)
+	}
+
+	if len(productIDs) == 0 {
+		return zeroReservationID, ErrNoProductIDs
+	}
+
+	var event *StoreEvent
+	var watchers []func()
+	defer func() {
+		s.publish(event)
+		notifyStockWatchers(watchers)
+	}()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Expired reservations are released even if the new one fails, so the
+	// watchers of the units they return are found before the store is
+	// unlocked on every return.
+	outOfStock := s.watchedOutOfStockLocked()
+	defer func() { watchers = s.backInStockLocked(outOfStock) }()
+
+	ID, err := s.generateReservationID()
+	if err != nil {
+		return zeroReservationID, err
+	}
+
+	now := s.now()
+	event = s.releaseExpiredReservationsLocked(now)
+
+	unitsReserved := make(map[productID]int)
+	for _, productID := range productIDs {
+		storeProduct, ok := s.products[productID]
+		if !ok {
+			return zeroReservationID, fmt.Errorf("%w: product with ID %s does not exist", ErrProductNotFound, productID.String())
+		}
+
+		unitsReserved[productID]++
+		if available := storeProduct.Quantity(); unitsReserved[productID] > available {
+			return zeroReservationID, fmt.Errorf("%w: product with ID %s has only %d unit(s) left", ErrOutOfStock, productID.String(), available)
+		}
+	}
+
+	r := &reservation{
+		id:        ID,
+		expiresAt: now.Add(ttl),
+	}
+	for productID, units := range unitsReserved {
+		storeProduct := s.products[productID]
+		r.lines = append(r.lines, orderLine{product: storeProduct, quantity: units})
+
+		product := storeProduct.Product()
+		product.quantity -= units
+		s.touch(product)
+		if product.quantity == 0 {
+			s.removeProductLocked(productID)
+		}
+	}
+	s.reservations[r.id] = r
+
+	return r.id, nil
+}
+
+// releaseReservation returns the units held by the reservation with the
+// specified ID to the store.
+func (s *store) releaseReservation(ID reservationID) error {
+	var event *StoreEvent
+	var watchers []func()
+	defer func() {
+		s.publish(event)
+		notifyStockWatchers(watchers)
+	}()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r, ok := s.reservations[ID]
+	if !ok {
+		return fmt.Errorf("%w: reservation with ID %s does not exist or has expired", ErrReservationNotFound, ID.String())
+	}
+
+	outOfStock := s.watchedOutOfStockLocked()
+	event = releasedEvent(s.releaseReservationLocked(r))
+	watchers = s.backInStockLocked(outOfStock)
+	return nil
+}
+
+// releaseExpiredReservations returns the units held by expired reservations to
+// the store. The write lock is only taken if a reservation has expired. Every
+// query of the available products calls it first, so the units of an expired
+// reservation are on sale whichever query runs first.
+func (s *store) releaseExpiredReservations() {
+	now := s.now()
+
+	s.mtx.RLock()
+	var hasExpired bool
+	for _, r := range s.reservations {
+		if r.expired(now) {
+			hasExpired = true
+			break
+		}
+	}
+	s.mtx.RUnlock()
+
+	if !hasExpired {
+		return
+	}
+
+	s.mtx.Lock()
+	outOfStock := s.watchedOutOfStockLocked()
+	event := s.releaseExpiredReservationsLocked(now)
+	watchers := s.backInStockLocked(outOfStock)
+	s.mtx.Unlock()
+
+	s.publish(event)
+	notifyStockWatchers(watchers)
+}
+
+// startReservationSweeper releases expired reservations every interval of the
+// store clock in a background goroutine. Queries and sales already release
+// them first, so the sweeper does not change what they see; it publishes
+// EventReservationsReleased for expired reservations while the store is idle.
+// The goroutine exits when ctx is cancelled.
+func (s *store) startReservationSweeper(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("%w: sweep interval must be positive", ErrInvalidArgument)
+	}
+
+	ticker := s.clock.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				s.releaseExpiredReservations()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// releaseExpiredReservationsLocked returns the units held by reservations
+// that have expired at the specified time to the store, and returns the event
+// to publish once the store is unlocked, or nil if none had expired. The
+// write lock must be held.
+func (s *store) releaseExpiredReservationsLocked(now time.Time) *StoreEvent {
+	var released []productID
+	for _, r := range s.reservations {
+		if r.expired(now) {
+			released = append(released, s.releaseReservationLocked(r)...)
+		}
+	}
+	return releasedEvent(released)
+}
+
+// releaseReservationLocked returns the units held by r to the store and
+// removes r. It returns the IDs of the products that had units returned. The
+// write lock must be held.
+func (s *store) releaseReservationLocked(r *reservation) []productID {
+	var released []productID
+	for _, line := range r.lines {
+		if line.quantity > 0 {
+			s.restockProduct(line.product, line.quantity)
+			released = append(released, line.product.ID())
+		}
+	}
+	delete(s.reservations, r.id)
+	return released
+}
+
+// releasedEvent returns an EventReservationsReleased event for the products
+// with the specified IDs, or nil if there are none.
+func releasedEvent(productIDs []productID) *StoreEvent {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	return &StoreEvent{Kind: EventReservationsReleased, ProductIDs: productIDs}
+}
+
+// generateReservationID generates a random non-zero ID that is not used by
+// any reservation. The write lock must be held.
+func (s *store) generateReservationID() (reservationID, error) {
+	var ID reservationID
+	for i := 0; i < maxIDGenerationAttempts; i++ {
+		if err := s.newID(ID[:]); err != nil {
+			return zeroReservationID, err
+		}
+
+		if _, exists := s.reservations[ID]; !ID.IsZero() && !exists {
+			return ID, nil
+		}
+	}
+
+	return zeroReservationID, fmt.Errorf("%w for a reservation", ErrIDGeneration)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestReservationSweeper(t *testing.T) {
+	s, _ := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1))
+	if _, err := s.reserve(time.Minute, IDs[0]); err != nil {
+		t.Fatalf("reserve error: %v", err)
+	}
+
+	released := make(chan StoreEvent, 1)
+	s.subscribe(func(event StoreEvent) {
+		if event.Kind == EventReservationsReleased {
+			released <- event
+		}
+	})
+
+	goroutines := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.startReservationSweeper(ctx, 30*time.Second); err != nil {
+		t.Fatalf("startReservationSweeper error: %v", err)
+	}
+
+	// The first sweep is before the reservation expires.
+	clock.advance(30 * time.Second)
+	clock.advance(30 * time.Second)
+	select {
+	case event := <-released:
+		if len(event.ProductIDs) != 1 || event.ProductIDs[0] != IDs[0] {
+			t.Fatalf("unexpected release event %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expired reservation was not released")
+	}
+	if p := s.product(IDs[0]); p == nil || p.Quantity() != 1 {
+		t.Fatalf("released units are not back in stock")
+	}
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("sweeper goroutine did not exit after the context was cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueriesCountExpiredReservations(t *testing.T) {
+	// queries return the number of results of the queries of the available
+	// products of s.
+	queries := map[string]func(s *store) int{
+		"availableProducts":   func(s *store) int { products, _ := s.availableProducts(""); return len(products) },
+		"availableProductIDs": func(s *store) int { return len(s.availableProductIDs("test")) },
+		"availableProductsInPriceRange": func(s *store) int {
+			products, _ := s.availableProductsInPriceRange("test", 0, 0)
+			return len(products)
+		},
+		"availableProductsByCategory": func(s *store) int { products, _ := s.availableProductsByCategory(""); return len(products) },
+		"categories":                  func(s *store) int { return len(s.categories()) },
+		"searchProducts":              func(s *store) int { return len(s.searchProducts("rice", false, false)) },
+		"fuzzySearch":                 func(s *store) int { return len(s.fuzzySearch("rice", 2)) },
+		"filterProducts":              func(s *store) int { products, _ := s.filterProducts(ByType("test")); return len(products) },
+		"productsByTag":               func(s *store) int { return len(s.productsByTag("grain")) },
+		"allTags":                     func(s *store) int { return len(s.allTags()) },
+		"carsByMake":                  func(s *store) int { return len(s.carsByMake("ford")) },
+		"carsByModel":                 func(s *store) int { return len(s.carsByModel("ecosport")) },
+		"agingProducts":               func(s *store) int { return len(s.agingProducts(time.Second)) },
+		"inStockCount":                func(s *store) int { return s.inStockCount("car") },
+		"forEachProduct": func(s *store) int {
+			var n int
+			s.forEachProduct(func(Product) bool { n++; return true })
+			return n
+		},
+	}
+
+	// queriedStore returns a store with a rice variant and a car, reserved
+	// if reserve is true, a minute after the reservation expired, and the
+	// IDs of the variant, the car and the parent of the variant.
+	queriedStore := func(reserve bool) (*store, []productID) {
+		s, _ := testStore(t)
+		clock := newFakeClock()
+		s.clock = clock
+		parent := mustAddProducts(t, s, testProduct(t, "Beans", 1000, 5))[0]
+		IDs := mustAddProducts(t, s,
+			testProduct(t, "Rice", 1000, 1, WithTags("grain"), WithCategory("Food"), WithParent(parent)),
+			testCar(t, "Ford", "Ecosport", "2020", 1))
+		if reserve {
+			if _, err := s.reserve(time.Minute, IDs...); err != nil {
+				t.Fatalf("reserve error: %v", err)
+			}
+		}
+		clock.advance(2 * time.Minute)
+		return s, append(IDs, parent)
+	}
+
+	for name, query := range queries {
+		unreserved, _ := queriedStore(false)
+		s, _ := queriedStore(true)
+		if got, want := query(s), query(unreserved); got != want {
+			t.Errorf("%s after a reservation expired = %d, want %d", name, got, want)
+		}
+	}
+
+	s, IDs := queriedStore(true)
+	if n := len(s.variants(IDs[2])); n != 1 {
+		t.Fatalf("variants after a reservation expired = %d, want 1", n)
+	}
+}
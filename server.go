@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxRequestBodySize is the maximum size of a request body accepted by a
+// Server.
+const maxRequestBodySize = 1 << 20
+
+// Server exposes a store as a JSON REST API. It supports the following
+// endpoints:
+//
+//	GET  /products       lists available products, optionally of ?type=
+//	GET  /products/{id}  returns a single product
+//	POST /products       adds a product and returns its ID
+//	POST /orders         processes an order and returns its ID
+//	GET  /orders         lists processed orders, optionally with ?status=
+type Server struct {
+	store *store
+	mux   *http.ServeMux
+}
+
+// newServer creates a Server for the specified store.
+func newServer(s *store) *Server {
+	srv := &Server{
+		store: s,
+		mux:   http.NewServeMux(),
+	}
+	srv.mux.HandleFunc("/products", srv.handleProducts)
+	srv.mux.HandleFunc("/products/", srv.handleProduct)
+	srv.mux.HandleFunc("/orders", srv.handleOrders)
+	srv.mux.HandleFunc("/metrics", srv.handleMetrics)
+	return srv
+}
+
+// ServeHTTP implements http.Handler for Server.
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
+// orderRequestJSON is the request body of POST /orders.
+type orderRequestJSON struct {
+	CustomerID      string                 `json:"customerID"`
+	AmountPaid      Money                  `json:"amountPaid"`
+	ShippingAddress string                 `json:"shippingAddress"`
+	Products        []orderLineRequestJSON `json:"products"`
+	DiscountCode    string                 `json:"discountCode,omitempty"`
+	ReservationID   string                 `json:"reservationID,omitempty"`
+	// PaymentMethod is "cash" if omitted. An unknown payment method is
+	// rejected.
+	PaymentMethod PaymentMethod `json:"paymentMethod,omitempty"`
+}
+
+// orderLineRequestJSON is a line of an orderRequestJSON.
+type orderLineRequestJSON struct {
+	ProductID string `json:"productID"`
+	Quantity  int    `json:"quantity"`
+}
+
+// idResponseJSON is the response body of requests that create a resource.
+type idResponseJSON struct {
+	ID string `json:"id"`
+}
+
+// errorResponseJSON is the response body of failed requests.
+type errorResponseJSON struct {
+	Error string `json:"error"`
+}
+
+// handleProducts handles GET and POST /products.
+func (srv *Server) handleProducts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		products, _ := srv.store.availableProductsSorted(r.URL.Query().Get("type"), SortByName)
+		if products == nil {
+			products = []Product{}
+		}
+		srv.writeJSON(w, http.StatusOK, products)
+
+	case http.MethodPost:
+		b, err := readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		p, err := unmarshalProduct(b)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid product: %w", err))
+			return
+		}
+
+		productIDs, err := srv.store.addProducts(p)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrIDGeneration) {
+				status = http.StatusInternalServerError
+			}
+			writeError(w, status, err)
+			return
+		}
+		srv.writeJSON(w, http.StatusCreated, idResponseJSON{ID: productIDs[0].String()})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleProduct handles GET /products/{id}.
+func (srv *Server) handleProduct(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rawID := strings.TrimPrefix(r.URL.Path, "/products/")
+	ID, err := parseProductID(rawID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("product with ID %q does not exist", rawID))
+		return
+	}
+
+	p := srv.store.product(ID)
+	if p == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("product with ID %s does not exist", ID.String()))
+		return
+	}
+	srv.writeJSON(w, http.StatusOK, p)
+}
+
+// handleOrders handles GET and POST /orders.
+func (srv *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var statuses []OrderStatus
+		for _, rawStatus := range r.URL.Query()["status"] {
+			var status OrderStatus
+			if err := status.UnmarshalText([]byte(rawStatus)); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			statuses = append(statuses, status)
+		}
+
+		orders, _, _ := srv.store.orders(statuses...)
+		ojs := make([]orderJSON, 0, len(orders))
+		srv.store.mtx.RLock()
+		for _, o := range orders {
+			oj, err := encodeOrder(o)
+			if err != nil {
+				srv.store.mtx.RUnlock()
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			ojs = append(ojs, oj)
+		}
+		srv.store.mtx.RUnlock()
+		srv.writeJSON(w, http.StatusOK, ojs)
+
+	case http.MethodPost:
+		b, err := readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var req orderRequestJSON
+		if err := json.Unmarshal(b, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid order: %w", err))
+			return
+		}
+
+		order, err := decodeOrderRequest(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ID, err := srv.store.sellProduct(order)
+		if err != nil {
+			writeError(w, orderErrorStatus(err), err)
+			return
+		}
+		srv.writeJSON(w, http.StatusCreated, idResponseJSON{ID: ID.String()})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// decodeOrderRequest creates an order from the body of POST /orders.
+func decodeOrderRequest(req orderRequestJSON) (*order, error) {
+	o := &order{
+		amountPaid:      req.AmountPaid,
+		shippingAddress: req.ShippingAddress,
+		discountCode:    req.DiscountCode,
+		paymentMethod:   req.PaymentMethod,
+	}
+
+	if err := decodeID(o.customerID[:], req.CustomerID); err != nil {
+		return nil, fmt.Errorf("invalid customer ID %q: %w", req.CustomerID, err)
+	}
+
+	if req.ReservationID != "" {
+		if err := decodeID(o.reservationID[:], req.ReservationID); err != nil {
+			return nil, fmt.Errorf("invalid reservation ID %q: %w", req.ReservationID, err)
+		}
+	}
+
+	for _, line := range req.Products {
+		ID, err := parseProductID(line.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		// The store sells its own copy of the product, so only the ID is
+		// needed.
+		o.products = append(o.products, orderLine{product: &product{id: ID}, quantity: line.Quantity})
+	}
+
+	return o, nil
+}
+
+// handleMetrics handles GET /metrics in the Prometheus text exposition format.
+func (srv *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = srv.store.WritePrometheus(w)
+}
+
+// orderErrorStatus returns the status code to respond with when an order
+// cannot be processed.
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrIDGeneration):
+		return http.StatusInternalServerError
+	case errors.Is(err, ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOutOfStock):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// writeJSON writes v as the JSON response body with the specified status code.
+// The store read lock is held while encoding, as v may reference products in
+// the store.
+func (srv *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	srv.store.mtx.RLock()
+	b, err := json.Marshal(v)
+	srv.store.mtx.RUnlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("json.Marshal error: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// writeError writes err as the JSON response body with the specified status
+// code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	b, _ := json.Marshal(errorResponseJSON{Error: err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// methodNotAllowed responds to a request with a method the endpoint does not
+// support.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// readBody reads the request body, up to maxRequestBodySize bytes.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingIDs is an IDGenerator that always fails.
+type failingIDs struct{}
+
+// NewID implements IDGenerator for failingIDs.
+func (failingIDs) NewID([]byte) error {
+	return errors.New("no entropy")
+}
+
+// serve sends a request with the specified method, path and body to srv and
+// returns the response.
+func serve(srv *Server, method, path, body string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, path, nil)
+	} else {
+		r = httptest.NewRequest(method, path, strings.NewReader(body))
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w
+}
+
+// orderRequest returns the body of POST /orders for units of the product
+// with the specified ID.
+func orderRequest(t *testing.T, buyer customerID, amountPaid Money, ID productID, units int) string {
+	t.Helper()
+	b, err := json.Marshal(orderRequestJSON{
+		CustomerID:      buyer.String(),
+		AmountPaid:      amountPaid,
+		ShippingAddress: "1 Marina Road, Lagos",
+		Products:        []orderLineRequestJSON{{ProductID: ID.String(), Quantity: units}},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal error: %v", err)
+	}
+	return string(b)
+}
+
+func TestServerProducts(t *testing.T) {
+	s, _ := testStore(t)
+	srv := newServer(s)
+
+	w := serve(srv, http.MethodGet, "/products", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("GET /products = %d %s, want 200 []", w.Code, w.Body.String())
+	}
+
+	body := `{"kind":"product","name":"Rice","price":"50.00","currency":"NGN","quantity":3,` +
+		`"product_type":"test","description":"A bag of rice.",` +
+		`"images":["https://example.com/rice.png"],"specifications":{"size":["M"]}}`
+	w = serve(srv, http.MethodPost, "/products", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /products = %d %s, want 201", w.Code, w.Body.String())
+	}
+	var created idResponseJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+
+	w = serve(srv, http.MethodGet, "/products/"+created.ID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /products/{id} = %d %s, want 200", w.Code, w.Body.String())
+	}
+	var pj productJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &pj); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	if pj.ID != created.ID || pj.Name != "Rice" || pj.Quantity != 3 {
+		t.Fatalf("GET /products/{id} returned %+v", pj)
+	}
+
+	w = serve(srv, http.MethodGet, "/products", "")
+	var pjs []productJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &pjs); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	if len(pjs) != 1 || pjs[0].ID != created.ID {
+		t.Fatalf("GET /products returned %+v, want the added product", pjs)
+	}
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"unknown product", http.MethodGet, "/products/" + strings.Repeat("0", 24), "", http.StatusNotFound},
+		{"malformed product ID", http.MethodGet, "/products/nope", "", http.StatusNotFound},
+		{"malformed product", http.MethodPost, "/products", "{", http.StatusBadRequest},
+		{"invalid product", http.MethodPost, "/products", `{"kind":"product","name":"Rice"}`, http.StatusBadRequest},
+		{"unsupported method", http.MethodDelete, "/products", "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(srv, test.method, test.path, test.body)
+			if w.Code != test.status {
+				t.Fatalf("%s %s = %d %s, want %d", test.method, test.path, w.Code, w.Body.String(), test.status)
+			}
+		})
+	}
+}
+
+func TestServerOrders(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 3))
+	srv := newServer(s)
+
+	w := serve(srv, http.MethodPost, "/orders", orderRequest(t, buyer, 10000, IDs[0], 2))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /orders = %d %s, want 201", w.Code, w.Body.String())
+	}
+	var created idResponseJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+
+	w = serve(srv, http.MethodGet, "/orders", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /orders = %d %s, want 200", w.Code, w.Body.String())
+	}
+	var ojs []orderJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &ojs); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	if len(ojs) != 1 || ojs[0].ID != created.ID {
+		t.Fatalf("GET /orders returned %+v, want the processed order", ojs)
+	}
+
+	tests := []struct {
+		name, body string
+		status     int
+	}{
+		{"malformed order", "{", http.StatusBadRequest},
+		{"underpaid order", orderRequest(t, buyer, 100, IDs[0], 1), http.StatusBadRequest},
+		{"unknown product", orderRequest(t, buyer, 10000, productID{1}, 1), http.StatusNotFound},
+		{"out of stock", orderRequest(t, buyer, 10000, IDs[0], 2), http.StatusConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(srv, http.MethodPost, "/orders", test.body)
+			if w.Code != test.status {
+				t.Fatalf("POST /orders = %d %s, want %d", w.Code, w.Body.String(), test.status)
+			}
+		})
+	}
+
+	if w := serve(srv, http.MethodGet, "/orders?status=nope", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("GET /orders?status=nope = %d, want 400", w.Code)
+	}
+}
+
+func TestServerIDGenerationFailure(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 3))
+	if err := s.setIDGenerator(failingIDs{}); err != nil {
+		t.Fatalf("setIDGenerator error: %v", err)
+	}
+	srv := newServer(s)
+
+	w := serve(srv, http.MethodPost, "/orders", orderRequest(t, buyer, 5000, IDs[0], 1))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("POST /orders = %d %s, want 500", w.Code, w.Body.String())
+	}
+
+	body := `{"kind":"product","name":"Beans","price":"30.00","currency":"NGN","quantity":1,` +
+		`"product_type":"test","description":"A bag of beans.",` +
+		`"images":["https://example.com/beans.png"],"specifications":{"size":["M"]}}`
+	w = serve(srv, http.MethodPost, "/products", body)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("POST /products = %d %s, want 500", w.Code, w.Body.String())
+	}
+
+	if p := s.product(IDs[0]); p.Quantity() != 3 {
+		t.Fatalf("product quantity after failed order is %d, want 3", p.Quantity())
+	}
+}
+
+func TestServerOrderPaymentMethod(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 3))
+	srv := newServer(s)
+
+	if w := serve(srv, http.MethodPost, "/orders", orderRequest(t, buyer, 5000, IDs[0], 1)); w.Code != http.StatusCreated {
+		t.Fatalf("POST /orders = %d %s, want 201", w.Code, w.Body.String())
+	}
+
+	body := strings.Replace(orderRequest(t, buyer, 5000, IDs[0], 1), "{", `{"paymentMethod":"cheque",`, 1)
+	if w := serve(srv, http.MethodPost, "/orders", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("POST /orders with unknown payment method = %d %s, want 400", w.Code, w.Body.String())
+	}
+
+	var ojs []orderJSON
+	if err := json.Unmarshal(serve(srv, http.MethodGet, "/orders", "").Body.Bytes(), &ojs); err != nil {
+		t.Fatalf("json.Unmarshal error: %v", err)
+	}
+	if len(ojs) != 1 || ojs[0].PaymentMethod != PaymentMethodCash {
+		t.Fatalf("GET /orders returned %+v, want one order paid in cash", ojs)
+	}
+}
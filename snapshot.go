@@ -0,0 +1,141 @@
+package main
+
+import "time"
+
+// StoreSnapshot is a point-in-time copy of the products, orders and customers
+// of a store. It does not change when the store does, so it can be read
+// without holding the store lock and without torn reads across queries. The
+// products and orders it returns must not be modified.
+type StoreSnapshot struct {
+	takenAt time.Time
+	// store is a private copy of the store that is only ever read.
+	store *store
+}
+
+// snapshot returns a StoreSnapshot of the store. Products and orders are deep
+// copied, and order lines of products still in stock share the copied
+// products.
+func (s *store) snapshot() StoreSnapshot {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	cp := newStore(s.name, s.currency)
+	cp.taxRate = s.taxRate
+	cp.minOrderAmount = s.minOrderAmount
+	cp.allowedTypes = s.allowedTypes
+	cp.clock = s.clock
+	cp.priceFormatter = s.priceFormatter
+
+	// copies maps the products of the store to their copies, so a product
+	// shared by the store and its orders is only copied once.
+	copies := make(map[Product]Product, len(s.products))
+	copyOf := func(p Product) Product {
+		if c, ok := copies[p]; ok {
+			return c
+		}
+		c := copyProduct(p)
+		copies[p] = c
+		return c
+	}
+
+	copyLines := func(lines []orderLine) []orderLine {
+		if lines == nil {
+			return nil
+		}
+		cpLines := make([]orderLine, len(lines))
+		for i, line := range lines {
+			cpLines[i] = orderLine{product: copyOf(line.product), quantity: line.quantity, price: line.price}
+		}
+		return cpLines
+	}
+
+	for _, p := range s.products {
+		cp.putProductLocked(copyOf(p))
+	}
+
+	for ID, o := range s.processedOrders {
+		cpOrder := *o
+		cpOrder.products = copyLines(o.products)
+		cpOrder.refundedProducts = copyLines(o.refundedProducts)
+		cpOrder.notes = o.Notes()
+		cp.processedOrders[ID] = &cpOrder
+	}
+
+	for ID, c := range s.customers {
+		cpCustomer := *c
+		cp.customers[ID] = &cpCustomer
+	}
+
+	return StoreSnapshot{
+		takenAt: s.now(),
+		store:   cp,
+	}
+}
+
+// TakenAt returns when the snapshot was taken.
+func (ss StoreSnapshot) TakenAt() time.Time {
+	return ss.takenAt
+}
+
+// availableProducts is like store.availableProducts for the snapshot.
+func (ss StoreSnapshot) availableProducts(productType string) ([]Product, Money) {
+	return ss.store.availableProducts(productType)
+}
+
+// availableProductsSorted is like store.availableProductsSorted for the
+// snapshot.
+func (ss StoreSnapshot) availableProductsSorted(productType string, option SortOption) ([]Product, Money) {
+	return ss.store.availableProductsSorted(productType, option)
+}
+
+// product is like store.product for the snapshot.
+func (ss StoreSnapshot) product(ID productID) Product {
+	return ss.store.product(ID)
+}
+
+// searchProducts is like store.searchProducts for the snapshot.
+func (ss StoreSnapshot) searchProducts(query string, searchSpecifications, searchMetadata bool) []Product {
+	return ss.store.searchProducts(query, searchSpecifications, searchMetadata)
+}
+
+// soldProducts is like store.soldProducts for the snapshot.
+func (ss StoreSnapshot) soldProducts(productType string) ([]Product, Money) {
+	return ss.store.soldProducts(productType)
+}
+
+// orders is like store.orders for the snapshot.
+func (ss StoreSnapshot) orders(statuses ...OrderStatus) ([]*order, Money, Money) {
+	return ss.store.orders(statuses...)
+}
+
+// ordersBetween is like store.ordersBetween for the snapshot.
+func (ss StoreSnapshot) ordersBetween(start, end time.Time) ([]*order, Money, error) {
+	return ss.store.ordersBetween(start, end)
+}
+
+// ordersByCustomer is like store.ordersByCustomer for the snapshot.
+func (ss StoreSnapshot) ordersByCustomer(ID customerID) ([]*order, Money) {
+	return ss.store.ordersByCustomer(ID)
+}
+
+// inventoryReport is like store.inventoryReport for the snapshot.
+func (ss StoreSnapshot) inventoryReport() InventoryReport {
+	return ss.store.inventoryReport()
+}
+
+// topSellingProducts is like store.topSellingProducts for the snapshot.
+func (ss StoreSnapshot) topSellingProducts(n int) []ProductSales {
+	return ss.store.topSellingProducts(n)
+}
+
+// profitReport is like store.profitReport for the snapshot.
+func (ss StoreSnapshot) profitReport() ProfitReport {
+	return ss.store.profitReport()
+}
+
+// revenueByType is like store.revenueByType for the snapshot.
+func (ss StoreSnapshot) revenueByType() map[string]Money {
+	return ss.store.revenueByType()
+}
@@ -0,0 +1,104 @@
+package main
+
+import "sync"
+
+// stockWatchers keeps track of the functions to call when a product type
+// comes back in stock.
+type stockWatchers struct {
+	mtx    sync.Mutex
+	nextID int
+	// fns are the watchers of each product type.
+	fns map[string]map[int]func()
+}
+
+// watchStock registers fn to be called every time products of the specified
+// type come back in stock after the store ran out of them, whichever change
+// returns units to stock: adding, restocking, restoring or transferring
+// products, cancelling, refunding or removing them from orders, or releasing
+// reservations. It returns a function that stops watching. fn is called
+// without the store lock held, so it can safely call back into the store.
+func (s *store) watchStock(productType string, fn func()) (unwatch func()) {
+	s.stockWatchers.mtx.Lock()
+	defer s.stockWatchers.mtx.Unlock()
+
+	if s.stockWatchers.fns == nil {
+		s.stockWatchers.fns = make(map[string]map[int]func())
+	}
+	if s.stockWatchers.fns[productType] == nil {
+		s.stockWatchers.fns[productType] = make(map[int]func())
+	}
+
+	ID := s.stockWatchers.nextID
+	s.stockWatchers.nextID++
+	s.stockWatchers.fns[productType][ID] = fn
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.stockWatchers.mtx.Lock()
+			delete(s.stockWatchers.fns[productType], ID)
+			if len(s.stockWatchers.fns[productType]) == 0 {
+				delete(s.stockWatchers.fns, productType)
+			}
+			s.stockWatchers.mtx.Unlock()
+		})
+	}
+}
+
+// watchedOutOfStockLocked returns the watched product types that have no
+// units in stock. The lock must be held.
+func (s *store) watchedOutOfStockLocked() map[string]bool {
+	s.stockWatchers.mtx.Lock()
+	outOfStock := make(map[string]bool, len(s.stockWatchers.fns))
+	for productType := range s.stockWatchers.fns {
+		outOfStock[productType] = true
+	}
+	s.stockWatchers.mtx.Unlock()
+
+	if len(outOfStock) == 0 {
+		return nil
+	}
+
+	for _, product := range s.products {
+		if product.Quantity() > 0 {
+			delete(outOfStock, product.Type())
+		}
+	}
+
+	return outOfStock
+}
+
+// backInStockLocked returns the watchers to call for the product types in
+// outOfStock that now have units in stock. The lock must be held.
+func (s *store) backInStockLocked(outOfStock map[string]bool) []func() {
+	if len(outOfStock) == 0 {
+		return nil
+	}
+
+	restocked := make(map[string]bool)
+	for _, product := range s.products {
+		if outOfStock[product.Type()] && product.Quantity() > 0 {
+			restocked[product.Type()] = true
+		}
+	}
+
+	s.stockWatchers.mtx.Lock()
+	defer s.stockWatchers.mtx.Unlock()
+
+	var fns []func()
+	for productType := range restocked {
+		for _, fn := range s.stockWatchers.fns[productType] {
+			fns = append(fns, fn)
+		}
+	}
+
+	return fns
+}
+
+// notifyStockWatchers calls the watchers returned by backInStockLocked. The
+// store lock must not be held.
+func notifyStockWatchers(fns []func()) {
+	for _, fn := range fns {
+		fn()
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStockWatchersReturnedUnits(t *testing.T) {
+	// Each test takes every unit of type test out of stock and returns the
+	// change that puts some back.
+	tests := []struct {
+		name       string
+		outOfStock func(t *testing.T, s *store, clock *fakeClock, buyer customerID, ID productID) func() error
+	}{
+		{"cancelOrder", func(t *testing.T, s *store, _ *fakeClock, buyer customerID, ID productID) func() error {
+			orderID, err := s.sellProduct(testOrder(buyer, 10000, line(t, s, ID, 1)))
+			if err != nil {
+				t.Fatalf("sellProduct error: %v", err)
+			}
+			return func() error { return s.cancelOrder(orderID) }
+		}},
+		{"updateOrderStatus", func(t *testing.T, s *store, _ *fakeClock, buyer customerID, ID productID) func() error {
+			orderID, err := s.sellProduct(testOrder(buyer, 10000, line(t, s, ID, 1)))
+			if err != nil {
+				t.Fatalf("sellProduct error: %v", err)
+			}
+			return func() error { return s.updateOrderStatus(orderID, OrderStatusCancelled) }
+		}},
+		{"refundOrderItems", func(t *testing.T, s *store, _ *fakeClock, buyer customerID, ID productID) func() error {
+			orderID, err := s.sellProduct(testOrder(buyer, 10000, line(t, s, ID, 1)))
+			if err != nil {
+				t.Fatalf("sellProduct error: %v", err)
+			}
+			return func() error {
+				_, err := s.refundOrderItems(orderID, ID)
+				return err
+			}
+		}},
+		{"removeFromOrder", func(t *testing.T, s *store, _ *fakeClock, buyer customerID, ID productID) func() error {
+			other := testProduct(t, "Soap", 500, 1)
+			other.productType = "other"
+			otherID := mustAddProducts(t, s, other)[0]
+			orderID, err := s.sellProduct(testOrder(buyer, 10000, line(t, s, ID, 1), line(t, s, otherID, 1)))
+			if err != nil {
+				t.Fatalf("sellProduct error: %v", err)
+			}
+			return func() error { return s.removeFromOrder(orderID, ID) }
+		}},
+		{"releaseReservation", func(t *testing.T, s *store, _ *fakeClock, _ customerID, ID productID) func() error {
+			reservationID, err := s.reserve(time.Minute, ID)
+			if err != nil {
+				t.Fatalf("reserve error: %v", err)
+			}
+			return func() error { return s.releaseReservation(reservationID) }
+		}},
+		{"expired reservation", func(t *testing.T, s *store, clock *fakeClock, _ customerID, ID productID) func() error {
+			if _, err := s.reserve(time.Minute, ID); err != nil {
+				t.Fatalf("reserve error: %v", err)
+			}
+			return func() error {
+				clock.advance(time.Minute)
+				s.releaseExpiredReservations()
+				return nil
+			}
+		}},
+		{"sale after a reservation expired", func(t *testing.T, s *store, clock *fakeClock, buyer customerID, ID productID) func() error {
+			other := testProduct(t, "Soap", 500, 1)
+			other.productType = "other"
+			otherID := mustAddProducts(t, s, other)[0]
+			if _, err := s.reserve(time.Minute, ID); err != nil {
+				t.Fatalf("reserve error: %v", err)
+			}
+			return func() error {
+				clock.advance(time.Minute)
+				_, err := s.sellProduct(testOrder(buyer, 10000, line(t, s, otherID, 1)))
+				return err
+			}
+		}},
+		{"restoreProduct", func(t *testing.T, s *store, _ *fakeClock, _ customerID, ID productID) func() error {
+			if _, err := s.deleteProducts(ID); err != nil {
+				t.Fatalf("deleteProducts error: %v", err)
+			}
+			return func() error { return s.restoreProduct(ID) }
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, buyer := testStore(t)
+			clock := newFakeClock()
+			s.clock = clock
+			ID := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1))[0]
+
+			returnUnits := test.outOfStock(t, s, clock, buyer, ID)
+			if s.inStock("test") {
+				t.Fatalf("expected type test to be out of stock")
+			}
+
+			// The watcher calls back into the store, which would deadlock
+			// if it were called with the store locked.
+			var calls int
+			s.watchStock("test", func() {
+				if !s.inStock("test") {
+					t.Errorf("stock watcher called while type test is out of stock")
+				}
+				calls++
+			})
+
+			if err := returnUnits(); err != nil {
+				t.Fatalf("%s error: %v", test.name, err)
+			}
+			if calls != 1 {
+				t.Fatalf("expected the stock watcher to be called once, got %d", calls)
+			}
+			checkInvariants(t, s)
+		})
+	}
+}
@@ -1,247 +1,2200 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
-	"errors"
 	"fmt"
-	"log"
+	"math"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxIDGenerationAttempts is the number of times generating a unique ID is
+// attempted before giving up.
+const maxIDGenerationAttempts = 10
+
 // store is the keeps track of all the existing and sold products.
 type store struct {
-	name            string
+	name string
+	// currency is the currency the prices of all products in the store are
+	// denominated in.
+	currency        Currency
 	mtx             sync.RWMutex
 	products        map[productID]Product
 	processedOrders map[orderID]*order
+	customers       map[customerID]*customer
+	discounts       map[string]Discount
+	// taxRate is the tax charged on orders in basis points, e.g. 750 for
+	// 7.5% VAT.
+	taxRate      int64
+	reservations map[reservationID]*reservation
+	subscribers  subscribers
+	// idGenerator generates the IDs of new products, orders, customers and
+	// reservations.
+	idGenerator IDGenerator
+	// lowStockThreshold is the quantity at or below which a product is
+	// considered low on stock. It is negative if low stock alerts are
+	// disabled.
+	lowStockThreshold int
+	// catalog is the catalog the store stocks products from, if the store is
+	// a branch of a chain.
+	catalog *Catalog
+	// maxImages is the maximum number of images a product can have.
+	maxImages int
+	// clock is the source of the current time for product dates, order
+	// timestamps, discounts and reservations.
+	clock clock
+	// duplicatePolicy is what addProducts does with duplicate products,
+	// and productSignature identifies them.
+	duplicatePolicy  DuplicatePolicy
+	productSignature ProductSignature
+	// archived are the products deleted from the store, which can be
+	// restored until they are purged.
+	archived map[productID]Product
+	// priceFormatter formats prices in product details and receipts.
+	priceFormatter PriceFormatter
+	stockWatchers  stockWatchers
+	// minOrderAmount is the smallest total the store sells an order for.
+	// Zero disables the minimum.
+	minOrderAmount Money
+	counters       storeCounters
+	// allowedTypes are the product types the store sells. The store sells
+	// products of any type if allowedTypes is empty.
+	allowedTypes map[string]bool
+	// seq is the order the store was created in, see lockStores.
+	seq uint64
+	// byType and byCategory index the products in stock by type and by
+	// lower case category. They are kept up to date by putProductLocked
+	// and removeProductLocked.
+	byType     productIndex
+	byCategory productIndex
+	// view is the current view of the products in stock, or nil if the
+	// products have changed since it was built.
+	view atomic.Pointer[productsView]
+	// lastView is the last view built, which the next view reuses the
+	// unchanged product types of. viewCopies are the copies of the products
+	// in stock that views are built from, or nil if there are none yet, and
+	// viewChanged are the IDs of the products changed since the copies were
+	// updated. viewChanged is written with the write lock held, and all
+	// three are read and updated with the read lock and viewMtx held.
+	viewMtx     sync.Mutex
+	lastView    *productsView
+	viewCopies  map[productID]Product
+	viewChanged map[productID]bool
+}
+
+// clock tells the current time. Tests can give a store a clock they control.
+type clock interface {
+	Now() time.Time
+	// NewTicker returns a ticker that ticks every d by the clock.
+	NewTicker(d time.Duration) ticker
+}
+
+// ticker delivers the ticks of a clock, like a time.Ticker.
+type ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// realClock is a clock that tells the real time.
+type realClock struct{}
+
+// Now returns the current local time.
+func (realClock) Now() time.Time {
+	return time.Now()
 }
 
-// newStore creates a new store.
-func newStore(name string) *store {
+// NewTicker returns a ticker that ticks every d of real time.
+func (realClock) NewTicker(d time.Duration) ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// realTicker is the ticker of realClock.
+type realTicker struct {
+	*time.Ticker
+}
+
+// C returns the channel the ticks are delivered on.
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// defaultMaxImages is the maximum number of images a product in a new store
+// can have.
+const defaultMaxImages = 10
+
+// newStore creates a new store that sells products in the specified currency.
+// If allowedTypes are specified, the store only sells products of those types.
+func newStore(name string, currency Currency, allowedTypes ...string) *store {
 	store := &store{
-		name:            name,
-		products:        make(map[productID]Product),
-		processedOrders: make(map[orderID]*order),
+		name:              name,
+		currency:          currency,
+		products:          make(map[productID]Product),
+		archived:          make(map[productID]Product),
+		processedOrders:   make(map[orderID]*order),
+		customers:         make(map[customerID]*customer),
+		discounts:         make(map[string]Discount),
+		reservations:      make(map[reservationID]*reservation),
+		idGenerator:       RandomIDs(rand.Reader),
+		lowStockThreshold: -1,
+		maxImages:         defaultMaxImages,
+		clock:             realClock{},
+		productSignature:  defaultProductSignature,
+		priceFormatter:    defaultPriceFormatter,
+		seq:               storeSeq.Add(1),
+		byType:            make(productIndex),
+		byCategory:        make(productIndex),
+	}
+
+	if len(allowedTypes) != 0 {
+		store.allowedTypes = make(map[string]bool, len(allowedTypes))
+		for _, productType := range allowedTypes {
+			store.allowedTypes[productType] = true
+		}
 	}
 
 	return store
 }
 
-// addProducts adds new product(s) and returns an array of product IDs.
+// sellsTypeLocked checks if the store sells products of the specified type.
+// The lock must be held.
+func (s *store) sellsTypeLocked(productType string) bool {
+	return len(s.allowedTypes) == 0 || s.allowedTypes[productType]
+}
+
+// now returns the current time of the store clock.
+func (s *store) now() time.Time {
+	return s.clock.Now()
+}
+
+// touch sets the last updated date of a product to the current time. It must
+// be called whenever a product in the store is changed.
+func (s *store) touch(p *product) {
+	now := s.now()
+	p.lastUpdated = &now
+	s.invalidateViewLocked(p.id)
+}
+
+// addProducts adds copies of new product(s) and returns an array of product
+// IDs. The store does not share the images or specifications of the products
+// with the caller, so changing them after they are added does not change the
+// store. Use the returned IDs to access the stored products. Duplicate
+// products are handled according to the duplicate policy of the store.
 func (s *store) addProducts(products ...Product) ([]productID, error) {
+	return s.addProductsCtx(context.Background(), products...)
+}
+
+// addProductsCtx is like addProducts but aborts without adding any product if
+// ctx is cancelled before the products are added.
+func (s *store) addProductsCtx(ctx context.Context, products ...Product) ([]productID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var event *StoreEvent
+	var watchers []func()
+	defer func() {
+		s.publish(event)
+		notifyStockWatchers(watchers)
+	}()
+
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
 	if len(products) == 0 {
-		return nil, errors.New("provide one or more products")
+		return nil, ErrNoProducts
 	}
 
 	// Validate products.
-	for _, product := range products {
+	copies := make([]Product, len(products))
+	for i, p := range products {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if p == nil || p.Product() == nil {
+			return nil, ErrInvalidProduct
+		}
+
+		product := copyProduct(p)
 		if product == nil {
-			return nil, errors.New("invalid product")
+			return nil, fmt.Errorf("%w: unsupported product type %T", ErrInvalidProduct, p)
+		}
+		product.Product().normalize()
+
+		if errs := product.Validate(); len(errs) != 0 {
+			return nil, fmt.Errorf("product at index %d is not valid: %w", i, &ValidationError{Errors: errs})
+		}
+
+		if err := s.checkNewProductLocked(product); err != nil {
+			return nil, err
 		}
 
-		if !product.IsValid() {
-			return nil, fmt.Errorf("product with ID %s is not valid or missing required fields", product.ID().String())
+		if parentID := product.Product().parentID; !parentID.IsZero() {
+			if _, ok := s.products[parentID]; !ok {
+				return nil, fmt.Errorf("%w: parent product with ID %s of product %q does not exist", ErrProductNotFound, parentID.String(), product.DisplayName())
+			}
 		}
+		copies[i] = product
 	}
 
-	now := time.Now()
+	duplicates, err := s.duplicatesLocked(copies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate new IDs for the products before adding any of them, so a
+	// failure does not leave the store partially updated.
 	productIDs := make([]productID, len(products))
-	for i, p := range products {
+	pending := make(map[productID]bool, len(products))
+	for i := range products {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := duplicates[i]; ok {
+			continue
+		}
+
+		productID, err := s.generateProductID(pending)
+		if err != nil {
+			return nil, err
+		}
+		productIDs[i] = productID
+		pending[productID] = true
+	}
+
+	outOfStock := s.watchedOutOfStockLocked()
+	now := s.now()
+	addedIDs := make([]productID, 0, len(copies))
+	for i, p := range copies {
+		// Duplicates are merged in order, so a product that duplicates
+		// an earlier one in the call already has its ID.
+		if original, ok := duplicates[i]; ok {
+			product := original.Product()
+			product.quantity += p.Quantity()
+			s.touch(product)
+			productIDs[i] = product.id
+			continue
+		}
+
 		product := p.Product()
+		product.id = productIDs[i]
+		addedIDs = append(addedIDs, product.id)
 
-		// Generate a new ID for this product.
-		s.generateProductID(product)
+		// Products without a currency are priced in the store currency.
+		if product.currency == "" {
+			product.currency = s.currency
+		}
 
 		// Set essential product dates.
 		product.createdAt = &now
 		product.lastUpdated = &now
 
-		// Add product to store products map and also add the product ID to
-		// return to callers.
-		productID := p.ID()
-		s.products[productID] = p
-		productIDs[i] = productID
+		// Add product to store products map.
+		s.putProductLocked(p)
 	}
 
+	if len(addedIDs) != 0 {
+		event = &StoreEvent{Kind: EventProductsAdded, ProductIDs: addedIDs}
+	}
+	s.counters.productsAdded.Add(uint64(len(addedIDs)))
+	watchers = s.backInStockLocked(outOfStock)
 	return productIDs, nil
 }
 
+// checkNewProductLocked checks that a valid product can be added to the
+// store: it must have a positive quantity, be priced in the store currency, be
+// of a type the store sells and have no more images than the store allows.
+// The lock must be held.
+func (s *store) checkNewProductLocked(product Product) error {
+	if product.Quantity() <= 0 {
+		return fmt.Errorf("%w: product %q must have a positive quantity", ErrInvalidProduct, product.DisplayName())
+	}
+
+	if currency := product.Currency(); currency != "" && currency != s.currency {
+		return fmt.Errorf("%w: product %q is priced in %s but %s only sells in %s", ErrInvalidProduct, product.DisplayName(), currency, s.name, s.currency)
+	}
+
+	if !s.sellsTypeLocked(product.Type()) {
+		return fmt.Errorf("%w %q: %s does not sell product %q", ErrUnknownProductType, product.Type(), s.name, product.DisplayName())
+	}
+
+	if len(product.Images()) > s.maxImages {
+		return fmt.Errorf("%w: product %q has %d images but at most %d are allowed", ErrInvalidProduct, product.DisplayName(), len(product.Images()), s.maxImages)
+	}
+
+	return nil
+}
+
 // sellProduct sells one or more product to a buyer and returns the order ID.
+// A product is removed from the store once all its units have been sold. If
+// the order references a reservation, the reserved units are sold first and
+// any units left over are released.
 func (s *store) sellProduct(order *order) (orderID, error) {
-	if order == nil || order.shippingAddress == "" || order.amountPaid <= 0 || order.name == "" || len(order.products) == 0 {
-		return zeroOrderID, errors.New("order is missing required fields")
+	return s.sellProductCtx(context.Background(), order)
+}
+
+// sellProductCtx is like sellProduct but aborts without changing the store if
+// ctx is cancelled before the order is processed.
+func (s *store) sellProductCtx(ctx context.Context, order *order) (orderID, error) {
+	if err := ctx.Err(); err != nil {
+		return zeroOrderID, err
 	}
 
-	var totalProductCost float64
-	for _, p := range order.products {
-		if p == nil {
-			return zeroOrderID, errors.New("invalid product")
-		}
+	if err := checkOrderFields(order); err != nil {
+		return zeroOrderID, err
+	}
 
-		if _, ok := s.products[p.ID()]; !ok {
-			return zeroOrderID, fmt.Errorf("product with ID %s does not exist", p.ID().String())
+	var events []*StoreEvent
+	var watchers []func()
+	defer func() {
+		for _, event := range events {
+			s.publish(event)
 		}
+		notifyStockWatchers(watchers)
+	}()
 
-		if !p.IsValid() {
-			return zeroOrderID, fmt.Errorf("product with ID(%s) is not valid", p.ID())
-		}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 
-		totalProductCost += p.Price()
-	}
+	// Expired reservations go back in stock even if the sale fails, and
+	// reserved units that are not bought when it succeeds, so the watchers
+	// of the units are found before the store is unlocked on every return.
+	outOfStock := s.watchedOutOfStockLocked()
+	defer func() { watchers = s.backInStockLocked(outOfStock) }()
 
-	// Check if buyer paid enough.
-	if order.amountPaid < totalProductCost {
-		return zeroOrderID, fmt.Errorf("order amount paid is not enough, need %f but paid %f", totalProductCost, order.amountPaid)
+	if err := ctx.Err(); err != nil {
+		return zeroOrderID, err
 	}
 
-	s.mtx.Lock()
-	for _, p := range order.products {
-		delete(s.products, p.ID())
+	now := s.now()
+	events = append(events, s.releaseExpiredReservationsLocked(now))
+
+	// The order is checked with the lock held, so the products cannot be
+	// sold or deleted before the store is changed.
+	check, err := s.checkOrderLocked(order, now)
+	if err != nil {
+		return zeroOrderID, err
 	}
 
 	// Generate new order ID.
-	s.generateOrderID(order)
-	s.processedOrders[order.id] = order
-	s.mtx.Unlock()
+	orderID, err := s.generateOrderID(nil)
+	if err != nil {
+		return zeroOrderID, err
+	}
 
+	events = append(events, s.commitOrderLocked(order, check, orderID, now)...)
 	return order.id, nil
 }
 
-// product returns a single product if it is found.
-func (s *store) product(ID productID) Product {
+// validateOrder runs the checks of sellProduct on the order and returns what
+// the buyer would pay, without changing the order or the products in the
+// store. The order may still fail when sold if the store changes in between.
+func (s *store) validateOrder(order *order) (Money, error) {
+	if err := checkOrderFields(order); err != nil {
+		return 0, err
+	}
+
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
-	product, ok := s.products[ID]
-	if !ok {
-		return nil
+
+	check, err := s.checkOrderLocked(order, s.now())
+	if err != nil {
+		return 0, err
 	}
-	return product
+
+	return check.total, nil
 }
 
-// availableProducts returns the available products matching the provided
-// product type, and their total cost if they are in stock. If no product type
-// is specified, all the products in the store, and their prices are returned.
-func (s *store) availableProducts(productType string) ([]Product, float64) {
-	s.mtx.RLock()
-	defer s.mtx.RUnlock()
-	var products []Product
-	var totalCost float64
+// sellProducts sells every order or none of them, and returns the order IDs in
+// the order of orders. Each order is sold like with sellProduct, but all the
+// orders are checked against the store before any is sold, so an order cannot
+// fail because an earlier one used up the stock it needs.
+func (s *store) sellProducts(orders ...*order) ([]orderID, error) {
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("%w: provide one or more orders", ErrInvalidArgument)
+	}
 
-	if productType == "" {
-		for _, product := range s.products {
-			products = append(products, product)
-			totalCost += product.Price()
+	seen := make(map[*order]bool, len(orders))
+	for i, order := range orders {
+		if err := checkOrderFields(order); err != nil {
+			return nil, fmt.Errorf("order at index %d: %w", i, err)
 		}
-		return products, totalCost
+
+		if seen[order] {
+			return nil, fmt.Errorf("%w: order at index %d is given more than once", ErrInvalidOrder, i)
+		}
+		seen[order] = true
 	}
 
-	for _, product := range s.products {
-		if product.Type() == productType {
-			products = append(products, product)
-			totalCost += product.Price()
+	var events []*StoreEvent
+	var watchers []func()
+	defer func() {
+		for _, event := range events {
+			s.publish(event)
+		}
+		notifyStockWatchers(watchers)
+	}()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Expired reservations go back in stock even if the sale fails, and
+	// reserved units that are not bought when it succeeds, so the watchers
+	// of the units are found before the store is unlocked on every return.
+	outOfStock := s.watchedOutOfStockLocked()
+	defer func() { watchers = s.backInStockLocked(outOfStock) }()
+
+	now := s.now()
+	events = append(events, s.releaseExpiredReservationsLocked(now))
+
+	checks := make([]*orderCheck, len(orders))
+	reserved := make(map[*reservation]bool)
+	// unitsFromStock is the number of units of each product the orders
+	// need from stock after the units they have reserved.
+	unitsFromStock := make(map[productID]int)
+	for i, order := range orders {
+		check, err := s.checkOrderLocked(order, now)
+		if err != nil {
+			return nil, fmt.Errorf("order at index %d: %w", i, err)
+		}
+		checks[i] = check
+
+		r := check.reservation
+		if r != nil {
+			if reserved[r] {
+				return nil, fmt.Errorf("%w: order at index %d uses reservation with ID %s of another order", ErrInvalidOrder, i, r.id.String())
+			}
+			reserved[r] = true
+		}
+
+		for productID, units := range check.unitsOrdered {
+			if r != nil {
+				units -= r.units(productID)
+			}
+			if units <= 0 {
+				continue
+			}
+
+			unitsFromStock[productID] += units
+			var inStock int
+			if storeProduct, ok := s.products[productID]; ok {
+				inStock = storeProduct.Quantity()
+			}
+			if unitsFromStock[productID] > inStock {
+				return nil, fmt.Errorf("%w: order at index %d: product with ID %s has only %d unit(s) left for the orders", ErrOutOfStock, i, productID.String(), inStock)
+			}
 		}
 	}
 
-	return products, totalCost
+	// Generate the order IDs before selling any order, so a failure does
+	// not leave the store partially updated.
+	orderIDs := make([]orderID, len(orders))
+	pending := make(map[orderID]bool, len(orders))
+	for i := range orders {
+		ID, err := s.generateOrderID(pending)
+		if err != nil {
+			return nil, err
+		}
+		orderIDs[i] = ID
+		pending[ID] = true
+	}
+
+	for i, order := range orders {
+		events = append(events, s.commitOrderLocked(order, checks[i], orderIDs[i], now)...)
+	}
+
+	return orderIDs, nil
 }
 
-// soldProducts returns the sold products matching the provided product type,
-// and their total cost. If no product type is specified, all the sold products
-// in the store, and their prices are returned.
-func (s *store) soldProducts(productType string) ([]Product, float64) {
-	s.mtx.RLock()
-	defer s.mtx.RUnlock()
+// checkOrderFields checks the fields of an order that do not depend on the
+// store.
+func checkOrderFields(order *order) error {
+	if order == nil || order.shippingAddress == "" || order.amountPaid <= 0 || order.customerID.IsZero() || len(order.products) == 0 {
+		return fmt.Errorf("%w: order is missing required fields", ErrInvalidOrder)
+	}
 
-	var products []Product
-	var totalCost float64
+	if !order.paymentMethod.isValid() {
+		return fmt.Errorf("%w: unknown payment method %s", ErrInvalidOrder, order.paymentMethod)
+	}
 
-	if productType == "" {
-		for _, orders := range s.processedOrders {
-			for _, product := range orders.products {
-				products = append(products, product)
-				totalCost += product.Price()
-			}
+	for _, line := range order.products {
+		if line.product == nil {
+			return fmt.Errorf("%w: invalid product", ErrInvalidOrder)
+		}
+
+		if line.quantity <= 0 {
+			return fmt.Errorf("%w: order quantity for product with ID %s must be positive", ErrInvalidOrder, line.product.ID().String())
 		}
-		return products, totalCost
 	}
 
-	for _, orders := range s.processedOrders {
-		for _, product := range orders.products {
-			if product.Type() == productType {
-				products = append(products, product)
-				totalCost += product.Price()
+	return nil
+}
+
+// commitOrderLocked sells a checked order with the specified ID, and returns
+// the events to publish once the store is unlocked. The write lock must be
+// held.
+func (s *store) commitOrderLocked(order *order, check *orderCheck, orderID orderID, now time.Time) []*StoreEvent {
+	var events []*StoreEvent
+	r := check.reservation
+	var lowStockIDs []productID
+	for productID, units := range check.unitsOrdered {
+		// Sell the reserved units first.
+		if r != nil {
+			if index := lineIndex(r.lines, productID); index != -1 {
+				reserved := r.lines[index].quantity
+				if reserved > units {
+					reserved = units
+				}
+				r.lines[index].quantity -= reserved
+				units -= reserved
 			}
 		}
+
+		if units == 0 {
+			continue
+		}
+
+		product := s.products[productID].Product()
+		wasLow := product.quantity <= s.lowStockThreshold
+		product.quantity -= units
+		s.touch(product)
+		if !wasLow && product.quantity <= s.lowStockThreshold {
+			lowStockIDs = append(lowStockIDs, productID)
+		}
+
+		if product.quantity == 0 {
+			s.removeProductLocked(productID)
+		}
 	}
 
-	return products, totalCost
+	// Release any reserved units that were not bought.
+	if r != nil {
+		events = append(events, releasedEvent(s.releaseReservationLocked(r)))
+	}
+
+	order.id = orderID
+	order.products = check.lines
+	order.status = OrderStatusPending
+	order.discountAmount = check.discountAmount
+	order.taxAmount = check.taxAmount
+	order.changeDue = order.amountPaid.Sub(check.total)
+	order.placedAt = &now
+	s.processedOrders[order.id] = order
+
+	soldIDs := make([]productID, 0, len(order.products))
+	var unitsSold uint64
+	for _, line := range order.products {
+		soldIDs = append(soldIDs, line.product.ID())
+		unitsSold += uint64(line.quantity)
+	}
+	s.counters.ordersSold.Add(1)
+	s.counters.unitsSold.Add(unitsSold)
+	events = append(events, &StoreEvent{Kind: EventProductsSold, ProductIDs: soldIDs, OrderID: order.id})
+	if len(lowStockIDs) != 0 {
+		events = append(events, &StoreEvent{Kind: EventLowStock, ProductIDs: lowStockIDs, OrderID: order.id})
+	}
+
+	return events
 }
 
-// orders returns a list of processed orders.
-func (s *store) orders() ([]*order, float64) {
-	s.mtx.RLock()
-	defer s.mtx.RUnlock()
-	var orders []*order
-	var totalPaid float64
-	for _, order := range s.processedOrders {
-		orders = append(orders, order)
-		totalPaid += order.amountPaid
+// orderCheck is the result of checking an order against the store.
+type orderCheck struct {
+	// reservation is the reservation referenced by the order, if any.
+	reservation *reservation
+	// lines are the order lines with the store's copy of each product.
+	lines        []orderLine
+	unitsOrdered map[productID]int
+	// subtotal is the cost of the products before discount and tax, and
+	// total is what the buyer must pay.
+	subtotal       Money
+	discountAmount Money
+	taxAmount      Money
+	total          Money
+}
+
+// checkOrderLocked checks that the order can be sold at the specified time and
+// returns what it costs. The store is not changed. The lock must be held.
+func (s *store) checkOrderLocked(order *order, now time.Time) (*orderCheck, error) {
+	if _, ok := s.customers[order.customerID]; !ok {
+		return nil, fmt.Errorf("%w: customer with ID %s does not exist", ErrInvalidOrder, order.customerID.String())
+	}
+
+	var r *reservation
+	if !order.reservationID.IsZero() {
+		var ok bool
+		r, ok = s.reservations[order.reservationID]
+		if !ok || r.expired(now) {
+			return nil, fmt.Errorf("%w: reservation with ID %s does not exist or has expired", ErrInvalidOrder, order.reservationID.String())
+		}
+	}
+
+	check, err := s.priceLinesLocked(order.products, r, order.discountCode, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if check.total < s.minOrderAmount {
+		return nil, fmt.Errorf("%w of %s, add %s more", ErrBelowMinimumOrder, s.minOrderAmount, s.minOrderAmount.Sub(check.total))
+	}
+
+	// Check if buyer paid enough.
+	if order.amountPaid < check.total {
+		return nil, fmt.Errorf("%w, need %s but paid %s", ErrInsufficientPayment, check.total, order.amountPaid)
 	}
-	return orders, totalPaid
+
+	return check, nil
 }
 
-// deleteProducts removes one or more available product from the store and
-// return the number of products deleted. It will be a no-op if product does not
-// exist.
-func (s *store) deleteProducts(productIDs ...productID) (int, error) {
-	if len(productIDs) == 0 {
-		return 0, errors.New("provide one or more product IDs")
+// priceLinesLocked checks that the products in lines can be sold at the
+// specified time, to the holder of reservation r if it is not nil, and returns
+// what they cost with the discount with the specified code, if any, and tax.
+// The store is not changed. The lock must be held.
+func (s *store) priceLinesLocked(lines []orderLine, r *reservation, discountCode string, now time.Time) (*orderCheck, error) {
+	check := &orderCheck{
+		reservation:  r,
+		lines:        make([]orderLine, len(lines)),
+		unitsOrdered: make(map[productID]int),
 	}
 
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
-	var deleted int
-	for _, productID := range productIDs {
-		if _, ok := s.products[productID]; ok {
-			delete(s.products, productID)
-			deleted++
+	for i, line := range lines {
+		// Sell the store's copy of the product, not the one in the order.
+		ID := line.product.ID()
+		p := s.saleProduct(ID, check.reservation, now)
+		available := s.availableUnits(ID, check.reservation, now)
+		if p == nil || available == 0 {
+			return nil, fmt.Errorf("%w: product with ID %s does not exist", ErrProductNotFound, ID.String())
+		}
+		check.lines[i] = orderLine{product: p, quantity: line.quantity, price: p.Price()}
+
+		if !sellable(p, now) {
+			return nil, fmt.Errorf("%w: product with ID %s cannot be sold at %s", ErrProductUnavailable, ID.String(), now.Format(time.RFC3339))
+		}
+
+		if !p.IsValid() {
+			return nil, fmt.Errorf("%w: product with ID %s is not valid", ErrInvalidOrder, ID.String())
+		}
+
+		if p.Currency() != s.currency {
+			return nil, fmt.Errorf("%w: product with ID %s is priced in %s but the order is in %s, cannot mix currencies in an order", ErrInvalidOrder, ID.String(), p.Currency(), s.currency)
+		}
+
+		check.unitsOrdered[ID] += line.quantity
+		if check.unitsOrdered[ID] > available {
+			return nil, fmt.Errorf("%w: product with ID %s has only %d unit(s) left", ErrOutOfStock, ID.String(), available)
+		}
+
+		var fits bool
+		if check.subtotal, fits = addCost(check.subtotal, p.Price(), line.quantity); !fits {
+			return nil, fmt.Errorf("%w: order products cost more than %s", ErrInvalidOrder, maxOrderSubtotal)
 		}
 	}
 
-	return deleted, nil
+	// Apply the order discount, if any.
+	total := check.subtotal
+	if discountCode != "" {
+		discount, err := s.discountLocked(discountCode, now)
+		if err != nil {
+			return nil, err
+		}
+		check.discountAmount = discount.amountOff(total)
+		total = total.Sub(check.discountAmount)
+	}
+
+	// Charge tax on the discounted product cost.
+	check.taxAmount = total.Percent(s.taxRate)
+	check.total = total.Add(check.taxAmount)
+
+	return check, nil
 }
 
-// inStock checks if the specified product type is in this store and
-// in stock.
-func (s *store) inStock(productType string) bool {
+// setTaxRate sets the tax rate charged on new orders in basis points, e.g. 750
+// for 7.5%. A zero tax rate disables tax.
+func (s *store) setTaxRate(basisPoints int64) error {
+	if basisPoints < 0 || basisPoints > basisPointsPerWhole {
+		return fmt.Errorf("%w: tax rate must be between 0 and 100 percent", ErrInvalidArgument)
+	}
+
+	s.mtx.Lock()
+	s.taxRate = basisPoints
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// tax returns the tax rate charged on new orders in basis points.
+func (s *store) tax() int64 {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
+	return s.taxRate
+}
 
-	for _, product := range s.products {
-		if product.Type() == productType {
-			return true
+// setMinOrderAmount sets the smallest total, after discount and tax, the store
+// sells an order for. A zero amount disables the minimum.
+func (s *store) setMinOrderAmount(amount Money) error {
+	if amount < 0 || amount > maxPrice {
+		return fmt.Errorf("%w: minimum order amount must be between 0 and %s", ErrInvalidArgument, maxPrice)
+	}
+
+	s.mtx.Lock()
+	s.minOrderAmount = amount
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// saleProduct returns the store's product with the specified ID, or the
+// product held by reservation r or by a reservation that has expired at the
+// specified time if it is not in stock. It returns nil if none has the
+// product. The lock must be held.
+func (s *store) saleProduct(ID productID, r *reservation, now time.Time) Product {
+	if storeProduct, ok := s.products[ID]; ok {
+		return storeProduct
+	}
+
+	if r != nil {
+		if index := lineIndex(r.lines, ID); index != -1 {
+			return r.lines[index].product
 		}
 	}
 
-	return false
+	for _, expired := range s.reservations {
+		if !expired.expired(now) {
+			continue
+		}
+		if index := lineIndex(expired.lines, ID); index != -1 {
+			return expired.lines[index].product
+		}
+	}
+
+	return nil
 }
 
-// generateProductID generates a random ID for a product.
-func (s *store) generateProductID(product *product) {
-	_, err := rand.Read(product.id[:])
-	if err != nil {
-		log.Println(err)
+// availableUnits returns the number of units of the product with the
+// specified ID that can be sold at the specified time to the holder of
+// reservation r, which may be nil. Units held by reservations that have
+// expired are counted as in stock, as they are released before a sale, so
+// checks that cannot change the store see the same stock as sellProduct. The
+// lock must be held.
+func (s *store) availableUnits(ID productID, r *reservation, now time.Time) int {
+	var units int
+	if storeProduct, ok := s.products[ID]; ok {
+		units = storeProduct.Quantity()
+	}
+
+	if r != nil {
+		units += r.units(ID)
+	}
+
+	for _, expired := range s.reservations {
+		if expired != r && expired.expired(now) {
+			units += expired.units(ID)
+		}
 	}
+
+	return units
 }
 
-// generateOrderID generates a random ID for an order.
-func (s *store) generateOrderID(product *order) {
-	_, err := rand.Read(product.id[:])
+// addCustomer adds a new customer to the store and returns the customer ID.
+func (s *store) addCustomer(customer *customer) (customerID, error) {
+	if !customer.IsValid() {
+		return zeroCustomerID, fmt.Errorf("%w: customer is not valid or missing required fields", ErrInvalidCustomer)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	customerID, err := s.generateCustomerID()
 	if err != nil {
-		log.Println(err)
+		return zeroCustomerID, err
+	}
+
+	customer.id = customerID
+	s.customers[customer.id] = customer
+
+	return customer.id, nil
+}
+
+// customer returns a single customer if it is found.
+func (s *store) customer(ID customerID) *customer {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.customers[ID]
+}
+
+// updateProduct applies fn to the product with the specified ID and bumps its
+// last updated date. The product is left unchanged if fn returns an error or
+// leaves the product invalid.
+func (s *store) updateProduct(ID productID, fn func(*product) error) error {
+	if fn == nil {
+		return fmt.Errorf("%w: provide a product update function", ErrInvalidArgument)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	storeProduct, ok := s.products[ID]
+	if !ok {
+		return fmt.Errorf("%w: product with ID %s does not exist", ErrProductNotFound, ID.String())
+	}
+
+	product := storeProduct.Product()
+	original := product.deepCopy()
+	if err := fn(product); err != nil {
+		*product = *original
+		return err
+	}
+	product.normalize()
+
+	if product.id != ID {
+		*product = *original
+		return fmt.Errorf("%w: product ID cannot be updated", ErrInvalidProduct)
+	}
+
+	if errs := storeProduct.Validate(); len(errs) != 0 {
+		*product = *original
+		return fmt.Errorf("updated product with ID %s is not valid: %w", ID.String(), &ValidationError{Errors: errs})
+	}
+
+	if product.quantity <= 0 {
+		*product = *original
+		return fmt.Errorf("%w: updated product with ID %s must have a positive quantity", ErrInvalidProduct, ID.String())
+	}
+
+	if !s.sellsTypeLocked(product.productType) {
+		productType := product.productType
+		*product = *original
+		return fmt.Errorf("%w %q: %s does not sell product with ID %s", ErrUnknownProductType, productType, s.name, ID.String())
+	}
+
+	if len(product.images) > s.maxImages {
+		*product = *original
+		return fmt.Errorf("%w: updated product with ID %s has %d images but at most %d are allowed", ErrInvalidProduct, ID.String(), len(product.images), s.maxImages)
+	}
+
+	s.reindexProductLocked(ID, original.productType, original.category)
+	s.touch(product)
+
+	return nil
+}
+
+// adjustPrices sets the price of every available product matching the
+// provided product type to the given percentage of its current price, and
+// returns the number of products updated. The percentage is in basis points,
+// e.g. 9000 to take 10% off. If no product type is specified, all the products
+// in the store are updated. No price is changed if any product would be left
+// invalid.
+func (s *store) adjustPrices(productType string, basisPoints int64) (int, error) {
+	if basisPoints <= 0 {
+		return 0, fmt.Errorf("%w: price adjustment must be positive", ErrInvalidArgument)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	originalPrices := make(map[*product]Money)
+	restore := func() {
+		for product, price := range originalPrices {
+			product.price = price
+		}
+	}
+
+	for _, storeProduct := range s.productsOfTypeLocked(productType) {
+		ID := storeProduct.ID()
+
+		product := storeProduct.Product()
+		if product.price > Money(math.MaxInt64/basisPoints) {
+			restore()
+			return 0, fmt.Errorf("%w: adjusted price of product with ID %s is too large", ErrInvalidProduct, ID.String())
+		}
+
+		originalPrices[product] = product.price
+		product.price = product.price.Percent(basisPoints)
+		if errs := storeProduct.Validate(); len(errs) != 0 {
+			restore()
+			return 0, fmt.Errorf("adjusted product with ID %s is not valid: %w", ID.String(), &ValidationError{Errors: errs})
+		}
+	}
+
+	for product := range originalPrices {
+		s.touch(product)
+	}
+
+	return len(originalPrices), nil
+}
+
+// duplicateProduct adds a copy of the product with the specified ID to the
+// store and returns the ID of the copy. modify, if not nil, is called to change
+// the copy before it is added, and can type assert it to change the fields of
+// a car. The copy does not share its images or specifications with the
+// original.
+func (s *store) duplicateProduct(ID productID, modify func(Product)) (productID, error) {
+	s.mtx.RLock()
+	storeProduct, ok := s.products[ID]
+	var cp Product
+	if ok {
+		cp = copyProduct(storeProduct)
+	}
+	s.mtx.RUnlock()
+
+	if !ok {
+		return zeroProductID, fmt.Errorf("%w: product with ID %s does not exist", ErrProductNotFound, ID.String())
+	}
+
+	if cp == nil {
+		return zeroProductID, fmt.Errorf("%w: unsupported product type %T", ErrInvalidProduct, storeProduct)
+	}
+
+	if modify != nil {
+		modify(cp)
+	}
+
+	productIDs, err := s.addProducts(cp)
+	if err != nil {
+		return zeroProductID, err
+	}
+
+	return productIDs[0], nil
+}
+
+// product returns a single product if it is found.
+func (s *store) product(ID productID) Product {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	product, ok := s.products[ID]
+	if !ok {
+		return nil
+	}
+	return product
+}
+
+// productsByID returns the available products with the specified IDs, and the
+// IDs of products that were not found, using a single lock.
+func (s *store) productsByID(IDs ...productID) (found []Product, missing []productID) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, ID := range IDs {
+		if product, ok := s.products[ID]; ok {
+			found = append(found, product)
+		} else {
+			missing = append(missing, ID)
+		}
+	}
+	return found, missing
+}
+
+// availableProducts returns the available products matching the provided
+// product type, and the total cost of their remaining units. If no product
+// type is specified, all the products in the store, and their total cost are
+// returned. Products outside their availability window are not available. The
+// products are copies read from the products view, so repeated calls between
+// changes to the store do not wait for the lock. The copies are shared by every
+// caller until the product changes, so they are read-only: use product for a
+// copy that can be changed. The slice is the caller's own.
+func (s *store) availableProducts(productType string) ([]Product, Money) {
+	view := s.productsView()
+	tv := view.byType[productType]
+	if productType == "" {
+		tv = view.allProducts()
+	}
+
+	if tv == nil {
+		return nil, 0
+	}
+	return append([]Product(nil), tv.products...), tv.cost
+}
+
+// sellable checks if a product can be sold at the specified time, which it can
+// if it is within its availability window. Every query of the available
+// products, the inventory report, price stats and CSV export, and every sale
+// use it so they agree on what is available. Restocking queries, lowStock and
+// reorderSuggestions, include products outside their window.
+func sellable(p Product, at time.Time) bool {
+	return p.Product().availableAt(at)
+}
+
+// availableProductIDs returns the sorted IDs of the available products
+// matching the provided product type. If no product type is specified, the IDs
+// of all the products in the store are returned.
+func (s *store) availableProductIDs(productType string) []productID {
+	s.releaseExpiredReservations()
+
+	now := s.now()
+	s.mtx.RLock()
+	products := s.productsOfTypeLocked(productType)
+	s.mtx.RUnlock()
+
+	IDs := make([]productID, 0, len(products))
+	for _, product := range products {
+		if sellable(product, now) {
+			IDs = append(IDs, product.ID())
+		}
+	}
+
+	sort.Slice(IDs, func(i, j int) bool {
+		return bytes.Compare(IDs[i][:], IDs[j][:]) < 0
+	})
+	return IDs
+}
+
+// forEachProduct calls fn for each available product until fn returns false.
+// fn is called with the store read lock held, so it must not call methods of
+// the store that change it, or it will deadlock.
+func (s *store) forEachProduct(fn func(Product) bool) {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	now := s.now()
+	for _, product := range s.products {
+		if sellable(product, now) && !fn(product) {
+			return
+		}
+	}
+}
+
+// availableProductsSorted is like availableProducts but the products are
+// sorted using the specified sort option.
+func (s *store) availableProductsSorted(productType string, option SortOption) ([]Product, Money) {
+	products, totalCost := s.availableProducts(productType)
+	sortProducts(products, option)
+	return products, totalCost
+}
+
+// availableProductsPaged returns a page of at most limit available products
+// matching the provided product type, starting at offset, and the total
+// number of matching products. Products are ordered by their creation date so
+// pages are stable across calls.
+func (s *store) availableProductsPaged(productType string, offset, limit int) ([]Product, int, error) {
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("%w: offset cannot be negative", ErrInvalidArgument)
+	}
+
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("%w: limit must be positive", ErrInvalidArgument)
+	}
+
+	products, _ := s.availableProductsSorted(productType, SortByCreatedAt)
+	total := len(products)
+	if offset >= total {
+		return nil, total, nil
+	}
+
+	if limit > total-offset {
+		limit = total - offset
+	}
+
+	return products[offset : offset+limit], total, nil
+}
+
+// availableProductsInPriceRange returns the available products matching the
+// provided product type whose price is within minPrice and maxPrice
+// (inclusive), and the total cost of their remaining units. A zero maxPrice
+// means there is no upper bound. No products are returned if minPrice is
+// greater than a non-zero maxPrice.
+func (s *store) availableProductsInPriceRange(productType string, minPrice, maxPrice Money) ([]Product, Money) {
+	if maxPrice != 0 && minPrice > maxPrice {
+		return nil, 0
+	}
+
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var products []Product
+	var totalCost Money
+
+	now := s.now()
+	for _, product := range s.productsOfTypeLocked(productType) {
+		price := product.Price()
+		if !sellable(product, now) || price < minPrice || (maxPrice != 0 && price > maxPrice) {
+			continue
+		}
+
+		products = append(products, product)
+		totalCost = totalCost.Add(price.Mul(int64(product.Quantity())))
+	}
+
+	return products, totalCost
+}
+
+// categories returns the sorted list of distinct categories of available
+// products. Categories that differ only in case are considered the same.
+func (s *store) categories() []string {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	// Map each category to a single spelling, picking the same one every
+	// time regardless of the map iteration order.
+	spellings := make(map[string]string)
+	now := s.now()
+	for _, p := range s.products {
+		category := p.Product().category
+		if category == "" || !sellable(p, now) {
+			continue
+		}
+
+		key := strings.ToLower(category)
+		if spelling, ok := spellings[key]; !ok || category < spelling {
+			spellings[key] = category
+		}
+	}
+
+	keys := make([]string, 0, len(spellings))
+	for key := range spellings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	categories := make([]string, len(keys))
+	for i, key := range keys {
+		categories[i] = spellings[key]
+	}
+	return categories
+}
+
+// availableProductsByCategory returns the available products in the provided
+// category, ignoring case, and the total cost of their remaining units.
+func (s *store) availableProductsByCategory(category string) ([]Product, Money) {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var products []Product
+	var totalCost Money
+	now := s.now()
+	for _, product := range s.productsInCategoryLocked(category) {
+		if sellable(product, now) {
+			products = append(products, product)
+			totalCost = totalCost.Add(product.Price().Mul(int64(product.Quantity())))
+		}
+	}
+	return products, totalCost
+}
+
+// variants returns the available products that are variants of the product
+// with the specified ID, sorted by name. The parent product does not need to
+// be in stock.
+func (s *store) variants(parentID productID) []Product {
+	if parentID.IsZero() {
+		return nil
+	}
+
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	var products []Product
+	now := s.now()
+	for _, product := range s.products {
+		if product.Product().parentID == parentID && sellable(product, now) {
+			products = append(products, product)
+		}
+	}
+	s.mtx.RUnlock()
+
+	sortProducts(products, SortByName)
+	return products
+}
+
+// productsByTag returns the available products tagged with tag, sorted by
+// name. Tags are not case sensitive.
+func (s *store) productsByTag(tag string) []Product {
+	if normalizeTag(tag) == "" {
+		return nil
+	}
+
+	products := findByPredicate(s, func(p Product) bool {
+		return p.Product().HasTag(tag)
+	})
+	sortProducts(products, SortByName)
+	return products
+}
+
+// allTags returns the tags of the available products, sorted and without
+// duplicates.
+func (s *store) allTags() []string {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	seen := make(map[string]bool)
+	var tags []string
+	now := s.now()
+	for _, product := range s.products {
+		if !sellable(product, now) {
+			continue
+		}
+		for _, tag := range product.Product().tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	s.mtx.RUnlock()
+
+	sort.Strings(tags)
+	return tags
+}
+
+// agingProducts returns the available products that were added to the store
+// more than olderThan ago, from the oldest. Products without a creation date
+// are not returned.
+func (s *store) agingProducts(olderThan time.Duration) []Product {
+	cutoff := s.now().Add(-olderThan)
+
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	var products []Product
+	now := s.now()
+	for _, product := range s.products {
+		if createdAt := product.Product().createdAt; createdAt != nil && createdAt.Before(cutoff) && sellable(product, now) {
+			products = append(products, product)
+		}
+	}
+	s.mtx.RUnlock()
+
+	sortProducts(products, SortByCreatedAt)
+	return products
+}
+
+// carsByMake returns the available cars of the specified make, ignoring case.
+func (s *store) carsByMake(carMake string) []*car {
+	return findByPredicate(s, func(c *car) bool { return strings.EqualFold(c.make, carMake) })
+}
+
+// carsByModel returns the available cars of the specified model, ignoring case.
+func (s *store) carsByModel(model string) []*car {
+	return findByPredicate(s, func(c *car) bool { return strings.EqualFold(c.model, model) })
+}
+
+// searchProducts returns the available products whose display name or
+// description contains query, ignoring case. If searchSpecifications is true,
+// products with a matching specification are also returned, and if
+// searchMetadata is true, products with a matching metadata value are also
+// returned. If query is empty, all the products in the store are returned.
+func (s *store) searchProducts(query string, searchSpecifications, searchMetadata bool) []Product {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var products []Product
+	now := s.now()
+	for _, p := range s.products {
+		if !sellable(p, now) {
+			continue
+		}
+		if query == "" || productMatches(p, query, searchSpecifications, searchMetadata) {
+			products = append(products, p)
+		}
+	}
+
+	return products
+}
+
+// productMatches checks if the lower case query is contained in the product's
+// display name, description or, if searchSpecifications is true, any of its
+// specifications or, if searchMetadata is true, any of its metadata values.
+func productMatches(p Product, query string, searchSpecifications, searchMetadata bool) bool {
+	if strings.Contains(strings.ToLower(p.DisplayName()), query) ||
+		strings.Contains(strings.ToLower(p.Product().description), query) {
+		return true
+	}
+
+	if searchMetadata {
+		for _, value := range p.Product().metadata {
+			if strings.Contains(strings.ToLower(value), query) {
+				return true
+			}
+		}
+	}
+
+	if !searchSpecifications {
+		return false
+	}
+
+	for specTitle, specInfo := range p.Product().specifications {
+		if strings.Contains(strings.ToLower(specTitle), query) {
+			return true
+		}
+
+		for _, specDesc := range specInfo {
+			if strings.Contains(strings.ToLower(specDesc), query) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// soldProducts returns the sold products matching the provided product type,
+// and their total cost. A product is listed once for every unit sold. If no
+// product type is specified, all the sold products in the store, and their
+// prices are returned. Products from cancelled orders are not considered sold.
+func (s *store) soldProducts(productType string) ([]Product, Money) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var products []Product
+	var totalCost Money
+
+	if productType == "" {
+		for _, orders := range s.processedOrders {
+			if orders.status == OrderStatusCancelled {
+				continue
+			}
+
+			for _, line := range orders.products {
+				products = appendUnits(products, line)
+				totalCost = totalCost.Add(line.cost())
+			}
+		}
+		return products, totalCost
+	}
+
+	for _, orders := range s.processedOrders {
+		if orders.status == OrderStatusCancelled {
+			continue
+		}
+
+		for _, line := range orders.products {
+			if line.product.Type() == productType {
+				products = appendUnits(products, line)
+				totalCost = totalCost.Add(line.cost())
+			}
+		}
+	}
+
+	return products, totalCost
+}
+
+// appendUnits appends the product of an order line to products once for every
+// unit in the line.
+func appendUnits(products []Product, line orderLine) []Product {
+	for i := 0; i < line.quantity; i++ {
+		products = append(products, line.product)
+	}
+	return products
+}
+
+// productsSoldTo returns the products sold to the customer with the specified
+// ID, listed once for every unit sold, and the total the customer spent on
+// their orders after discounts, tax and refunds. Products from cancelled
+// orders are not considered sold.
+func (s *store) productsSoldTo(ID customerID) ([]Product, Money) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var products []Product
+	var totalSpent Money
+	for _, order := range s.processedOrders {
+		if order.customerID != ID || order.status == OrderStatusCancelled {
+			continue
+		}
+
+		for _, line := range order.products {
+			products = appendUnits(products, line)
+		}
+		totalSpent = totalSpent.Add(order.revenue())
+	}
+
+	return products, totalSpent
+}
+
+// soldProductsSorted is like soldProducts but the products are sorted using
+// the specified sort option.
+func (s *store) soldProductsSorted(productType string, option SortOption) ([]Product, Money) {
+	products, totalCost := s.soldProducts(productType)
+	sortProducts(products, option)
+	return products, totalCost
+}
+
+// orders returns a list of processed orders from the earliest placed, the
+// revenue from them and the cash received for them, both less refunds. Change
+// given to customers is not revenue. If one or more statuses are specified,
+// only orders with any of the statuses are returned.
+func (s *store) orders(statuses ...OrderStatus) ([]*order, Money, Money) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var orders []*order
+	var revenue, received Money
+	for _, order := range s.processedOrders {
+		if len(statuses) != 0 && !hasOrderStatus(statuses, order.status) {
+			continue
+		}
+
+		orders = append(orders, order)
+		revenue = revenue.Add(order.revenue())
+		received = received.Add(order.amountPaid.Sub(order.refundedAmount))
+	}
+	sortOrders(orders)
+	return orders, revenue, received
+}
+
+// taxCollected returns the total tax charged on orders that have not been
+// cancelled.
+func (s *store) taxCollected() Money {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var totalTax Money
+	for _, order := range s.processedOrders {
+		if order.status != OrderStatusCancelled {
+			totalTax = totalTax.Add(order.taxAmount)
+		}
+	}
+	return totalTax
+}
+
+// ordersBetween returns a list of processed orders placed from start up to but
+// not including end, from the earliest placed, and the revenue from them less
+// refunds.
+func (s *store) ordersBetween(start, end time.Time) ([]*order, Money, error) {
+	if end.Before(start) {
+		return nil, 0, fmt.Errorf("%w: end of the time range is before its start", ErrInvalidArgument)
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var orders []*order
+	var revenue Money
+	for _, order := range s.processedOrders {
+		if order.placedAt == nil || order.placedAt.Before(start) || !order.placedAt.Before(end) {
+			continue
+		}
+
+		orders = append(orders, order)
+		revenue = revenue.Add(order.revenue())
+	}
+	sortOrders(orders)
+	return orders, revenue, nil
+}
+
+// ordersByCustomer returns a list of processed orders placed by the customer
+// with the specified ID from the earliest placed, and the revenue from them
+// less refunds.
+func (s *store) ordersByCustomer(ID customerID) ([]*order, Money) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var orders []*order
+	var revenue Money
+	for _, order := range s.processedOrders {
+		if order.customerID == ID {
+			orders = append(orders, order)
+			revenue = revenue.Add(order.revenue())
+		}
+	}
+	sortOrders(orders)
+	return orders, revenue
+}
+
+// salesForProduct returns the processed orders that sold the product with the
+// specified ID, from the earliest placed. Orders that have since refunded the
+// product are included, but cancelled orders are not.
+func (s *store) salesForProduct(ID productID) []*order {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var orders []*order
+	for _, order := range s.processedOrders {
+		if order.status == OrderStatusCancelled {
+			continue
+		}
+
+		if lineIndex(order.products, ID) != -1 || lineIndex(order.refundedProducts, ID) != -1 {
+			orders = append(orders, order)
+		}
+	}
+	sortOrders(orders)
+	return orders
+}
+
+// addOrderNote adds a note by author to the processed order with the specified
+// ID. Notes cannot be changed or removed once added.
+func (s *store) addOrderNote(ID orderID, author, text string) error {
+	author, text = strings.TrimSpace(author), strings.TrimSpace(text)
+	if author == "" || text == "" {
+		return fmt.Errorf("%w: order note must have an author and text", ErrInvalidArgument)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	order, ok := s.processedOrders[ID]
+	if !ok {
+		return fmt.Errorf("%w: order with ID %s does not exist", ErrOrderNotFound, ID.String())
+	}
+
+	order.notes = append(order.notes, orderNote{author: author, text: text, createdAt: s.now()})
+	return nil
+}
+
+// updateOrderStatus moves the order with the specified ID to a new status.
+// Cancelling an order returns its products to the store.
+func (s *store) updateOrderStatus(ID orderID, status OrderStatus) error {
+	var watchers []func()
+	defer func() { notifyStockWatchers(watchers) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	order, ok := s.processedOrders[ID]
+	if !ok {
+		return fmt.Errorf("%w: order with ID %s does not exist", ErrOrderNotFound, ID.String())
+	}
+
+	if !order.status.canTransitionTo(status) {
+		return fmt.Errorf("%w: order with ID %s cannot be moved from %s to %s", ErrInvalidStatusChange, ID.String(), order.status, status)
+	}
+
+	if status == OrderStatusCancelled {
+		outOfStock := s.watchedOutOfStockLocked()
+		s.restockOrderProducts(order)
+		watchers = s.backInStockLocked(outOfStock)
+	}
+
+	order.status = status
+	return nil
+}
+
+// cancelOrder cancels the order with the specified ID and returns its products
+// to the store under their original IDs. The cancelled order is kept for
+// record purposes but its products are no longer considered sold.
+func (s *store) cancelOrder(ID orderID) error {
+	var watchers []func()
+	defer func() { notifyStockWatchers(watchers) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	order, ok := s.processedOrders[ID]
+	if !ok {
+		return fmt.Errorf("%w: order with ID %s does not exist", ErrOrderNotFound, ID.String())
+	}
+
+	if order.status == OrderStatusCancelled {
+		return fmt.Errorf("%w: order with ID %s has already been cancelled", ErrInvalidStatusChange, ID.String())
+	}
+
+	if !order.status.canTransitionTo(OrderStatusCancelled) {
+		return fmt.Errorf("%w: order with ID %s cannot be cancelled after it is %s", ErrInvalidStatusChange, ID.String(), order.status)
+	}
+
+	outOfStock := s.watchedOutOfStockLocked()
+	s.restockOrderProducts(order)
+	order.status = OrderStatusCancelled
+	watchers = s.backInStockLocked(outOfStock)
+	return nil
+}
+
+// refundOrderItems removes one unit of each of the specified products from the
+// order with the specified ID, returns them to the store and records the
+// refunded amount on the order. The refunded amount is returned. The customer
+// is paid back their share of what they were charged for the order, so the
+// discount and tax of the order are spread across its products, and an order
+// is never refunded more than it was paid.
+func (s *store) refundOrderItems(ID orderID, productIDs ...productID) (Money, error) {
+	if len(productIDs) == 0 {
+		return 0, ErrNoProductIDs
+	}
+
+	var watchers []func()
+	defer func() { notifyStockWatchers(watchers) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	order, ok := s.processedOrders[ID]
+	if !ok {
+		return 0, fmt.Errorf("%w: order with ID %s does not exist", ErrOrderNotFound, ID.String())
+	}
+
+	if order.status == OrderStatusCancelled {
+		return 0, fmt.Errorf("%w: order with ID %s has been cancelled", ErrInvalidOrder, ID.String())
+	}
+
+	// Find the products to refund before changing the order, so an invalid
+	// product ID leaves the order unchanged.
+	remaining := append([]orderLine(nil), order.products...)
+	var refunded []orderLine
+	for _, productID := range productIDs {
+		index := unitLineIndex(remaining, productID)
+		if index == -1 {
+			if lineIndex(order.refundedProducts, productID) != -1 {
+				return 0, fmt.Errorf("%w: product with ID %s has already been refunded", ErrInvalidOrder, productID.String())
+			}
+			return 0, fmt.Errorf("%w: product with ID %s is not in order %s", ErrProductNotFound, productID.String(), ID.String())
+		}
+
+		remaining[index].quantity--
+		refunded = addToLines(refunded, remaining[index].product, remaining[index].price, 1)
+	}
+
+	// The subtotal includes the products refunded before, like the order
+	// total.
+	var subtotal, refundedCost, remainingCost Money
+	for _, lines := range [][]orderLine{order.products, order.refundedProducts} {
+		for _, line := range lines {
+			subtotal = subtotal.Add(line.cost())
+		}
+	}
+	for _, line := range refunded {
+		refundedCost = refundedCost.Add(line.cost())
+	}
+	for _, line := range remaining {
+		remainingCost = remainingCost.Add(line.cost())
+	}
+
+	// The last products refunded get whatever is left of the payment, so
+	// rounding never leaves part of it unrefunded.
+	charged := order.amountPaid.Sub(order.changeDue)
+	left := charged.Sub(order.refundedAmount)
+	refundedAmount := charged.Prorate(refundedCost, subtotal)
+	if refundedAmount > left || remainingCost == 0 {
+		refundedAmount = left
+	}
+	if refundedAmount < 0 {
+		refundedAmount = 0
+	}
+
+	outOfStock := s.watchedOutOfStockLocked()
+	for _, line := range refunded {
+		s.restockProduct(line.product, line.quantity)
+		order.refundedProducts = addToLines(order.refundedProducts, line.product, line.price, line.quantity)
+	}
+
+	// Drop the order lines that have been fully refunded.
+	order.products = order.products[:0]
+	for _, line := range remaining {
+		if line.quantity > 0 {
+			order.products = append(order.products, line)
+		}
+	}
+	order.refundedAmount = order.refundedAmount.Add(refundedAmount)
+	watchers = s.backInStockLocked(outOfStock)
+
+	return refundedAmount, nil
+}
+
+// addToOrder adds one unit of each of the specified products to the pending
+// order with the specified ID at their current price, and takes them out of
+// stock. Products outside their availability window cannot be added. The
+// discount, tax and change due of the order are recomputed, and the
+// order has a balance due if it now costs more than was paid.
+func (s *store) addToOrder(ID orderID, productIDs ...productID) error {
+	if len(productIDs) == 0 {
+		return ErrNoProductIDs
+	}
+
+	var event *StoreEvent
+	defer func() { s.publish(event) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	order, err := s.changeableOrderLocked(ID)
+	if err != nil {
+		return err
+	}
+
+	// Check every product before changing the order, so an unknown, sold
+	// out or unavailable product leaves the order unchanged.
+	now := s.now()
+	subtotal := order.subtotal()
+	unitsAdded := make(map[productID]int)
+	for _, productID := range productIDs {
+		storeProduct, ok := s.products[productID]
+		if !ok {
+			return fmt.Errorf("%w: product with ID %s does not exist", ErrProductNotFound, productID.String())
+		}
+
+		if !sellable(storeProduct, now) {
+			return fmt.Errorf("%w: product with ID %s cannot be sold at %s", ErrProductUnavailable, productID.String(), now.Format(time.RFC3339))
+		}
+
+		unitsAdded[productID]++
+		if available := storeProduct.Quantity(); unitsAdded[productID] > available {
+			return fmt.Errorf("%w: product with ID %s has only %d unit(s) left", ErrOutOfStock, productID.String(), available)
+		}
+
+		var fits bool
+		if subtotal, fits = addCost(subtotal, storeProduct.Price(), 1); !fits {
+			return fmt.Errorf("%w: order products cost more than %s", ErrInvalidOrder, maxOrderSubtotal)
+		}
+	}
+
+	for _, productID := range productIDs {
+		storeProduct := s.products[productID]
+		order.products = addToLines(order.products, storeProduct, storeProduct.Price(), 1)
+	}
+
+	addedIDs := make([]productID, 0, len(unitsAdded))
+	for productID, units := range unitsAdded {
+		product := s.products[productID].Product()
+		product.quantity -= units
+		s.touch(product)
+		if product.quantity == 0 {
+			s.removeProductLocked(productID)
+		}
+		addedIDs = append(addedIDs, productID)
+	}
+	s.repriceOrderLocked(order)
+
+	event = &StoreEvent{Kind: EventProductsSold, ProductIDs: addedIDs, OrderID: order.id}
+	return nil
+}
+
+// removeFromOrder removes one unit of each of the specified products from the
+// pending order with the specified ID and returns them to the store. The
+// discount, tax and change due of the order are recomputed. Use cancelOrder to
+// remove every product.
+func (s *store) removeFromOrder(ID orderID, productIDs ...productID) error {
+	if len(productIDs) == 0 {
+		return ErrNoProductIDs
+	}
+
+	var watchers []func()
+	defer func() { notifyStockWatchers(watchers) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	order, err := s.changeableOrderLocked(ID)
+	if err != nil {
+		return err
+	}
+
+	// Find the products to remove before changing the order, so an invalid
+	// product ID leaves the order unchanged.
+	remaining := append([]orderLine(nil), order.products...)
+	var removed []orderLine
+	var unitsLeft int
+	for _, line := range remaining {
+		unitsLeft += line.quantity
+	}
+	for _, productID := range productIDs {
+		index := unitLineIndex(remaining, productID)
+		if index == -1 {
+			return fmt.Errorf("%w: product with ID %s is not in order %s", ErrProductNotFound, productID.String(), ID.String())
+		}
+
+		remaining[index].quantity--
+		removed = addToLines(removed, remaining[index].product, remaining[index].price, 1)
+		unitsLeft--
+	}
+
+	if unitsLeft == 0 {
+		return fmt.Errorf("%w: cannot remove every product from order %s, cancel it instead", ErrInvalidOrder, ID.String())
+	}
+
+	outOfStock := s.watchedOutOfStockLocked()
+	for _, line := range removed {
+		s.restockProduct(line.product, line.quantity)
+	}
+	watchers = s.backInStockLocked(outOfStock)
+
+	order.products = order.products[:0]
+	for _, line := range remaining {
+		if line.quantity > 0 {
+			order.products = append(order.products, line)
+		}
+	}
+	s.repriceOrderLocked(order)
+
+	return nil
+}
+
+// changeableOrderLocked returns the order with the specified ID if its products
+// can still be changed, which is until it is shipped. The lock must be held.
+func (s *store) changeableOrderLocked(ID orderID) (*order, error) {
+	order, ok := s.processedOrders[ID]
+	if !ok {
+		return nil, fmt.Errorf("%w: order with ID %s does not exist", ErrOrderNotFound, ID.String())
+	}
+
+	if order.status != OrderStatusPending {
+		return nil, fmt.Errorf("%w: order with ID %s is %s and can no longer be changed", ErrInvalidOrder, ID.String(), order.status)
+	}
+
+	return order, nil
+}
+
+// repriceOrderLocked recomputes the discount, tax and change or balance due of
+// an order after its products change. Refunded products still count towards
+// the order total, as they are paid back separately. The discount of the order
+// is kept if its code has since been removed, and tax is charged at the
+// current rate. The lock must be held.
+func (s *store) repriceOrderLocked(order *order) {
+	subtotal := order.subtotal()
+
+	if discount, ok := s.discounts[normalizeDiscountCode(order.discountCode)]; ok && order.discountCode != "" {
+		order.discountAmount = discount.amountOff(subtotal)
+	} else if order.discountAmount > subtotal {
+		order.discountAmount = subtotal
+	}
+
+	total := subtotal.Sub(order.discountAmount)
+	order.taxAmount = total.Percent(s.taxRate)
+	total = total.Add(order.taxAmount)
+
+	order.changeDue, order.balanceDue = 0, 0
+	if order.amountPaid >= total {
+		order.changeDue = order.amountPaid.Sub(total)
+	} else {
+		order.balanceDue = total.Sub(order.amountPaid)
+	}
+}
+
+// restockOrderProducts returns the products of an order to the store. The
+// write lock must be held.
+func (s *store) restockOrderProducts(order *order) {
+	for _, line := range order.products {
+		s.restockProduct(line.product, line.quantity)
+	}
+}
+
+// restockProduct returns units of a sold product to the store. The product is
+// re-added under its original ID if it was sold out, and the units are added to
+// the archived product if it was deleted. The write lock must be held.
+func (s *store) restockProduct(p Product, units int) {
+	if archivedProduct, ok := s.archived[p.ID()]; ok {
+		product := archivedProduct.Product()
+		product.quantity += units
+		s.touch(product)
+		return
+	}
+
+	if storeProduct, ok := s.products[p.ID()]; ok {
+		product := storeProduct.Product()
+		product.quantity += units
+		s.touch(product)
+		return
+	}
+
+	product := p.Product()
+	product.quantity = units
+	s.touch(product)
+	s.putProductLocked(p)
+}
+
+// addToLines adds units of a product sold at price to the order line in lines
+// for the product at that price, or appends a new order line if there is none.
+func addToLines(lines []orderLine, p Product, price Money, units int) []orderLine {
+	for i, line := range lines {
+		if line.product.ID() == p.ID() && line.price == price {
+			lines[i].quantity += units
+			return lines
+		}
+	}
+	return append(lines, orderLine{product: p, quantity: units, price: price})
+}
+
+// hasOrderStatus checks if status is one of statuses.
+func hasOrderStatus(statuses []OrderStatus, status OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteProducts removes one or more available product from the store and
+// return the number of products deleted. It will be a no-op if product does not
+// exist. Deleted products are archived, and can be restored with
+// restoreProduct or deleted for good with purgeProducts.
+func (s *store) deleteProducts(productIDs ...productID) (int, error) {
+	return s.deleteProductsCtx(context.Background(), productIDs...)
+}
+
+// deleteProductsCtx is like deleteProducts but aborts without deleting any
+// product if ctx is cancelled before the products are deleted.
+func (s *store) deleteProductsCtx(ctx context.Context, productIDs ...productID) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(productIDs) == 0 {
+		return 0, ErrNoProductIDs
+	}
+
+	var event *StoreEvent
+	defer func() { s.publish(event) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var deletedIDs []productID
+	for _, productID := range productIDs {
+		if product, ok := s.products[productID]; ok {
+			s.archiveLocked(product)
+			deletedIDs = append(deletedIDs, productID)
+		}
+	}
+
+	if len(deletedIDs) != 0 {
+		event = &StoreEvent{Kind: EventProductsDeleted, ProductIDs: deletedIDs}
+	}
+	s.counters.productsDeleted.Add(uint64(len(deletedIDs)))
+
+	return len(deletedIDs), nil
+}
+
+// deleteProductsByType removes all available products of the specified type
+// from the store and returns the number of products deleted. It will be a
+// no-op if there are no products of the type. Deleted products are archived
+// like with deleteProducts.
+func (s *store) deleteProductsByType(productType string) (int, error) {
+	if productType == "" {
+		return 0, fmt.Errorf("%w: product type is required", ErrInvalidArgument)
+	}
+
+	var event *StoreEvent
+	defer func() { s.publish(event) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var deletedIDs []productID
+	for _, product := range s.productsOfTypeLocked(productType) {
+		s.archiveLocked(product)
+		deletedIDs = append(deletedIDs, product.ID())
+	}
+
+	if len(deletedIDs) != 0 {
+		event = &StoreEvent{Kind: EventProductsDeleted, ProductIDs: deletedIDs}
+	}
+	s.counters.productsDeleted.Add(uint64(len(deletedIDs)))
+
+	return len(deletedIDs), nil
+}
+
+// restock adds additional units to the quantity of the product with the
+// specified ID. Products that have sold out are no longer in the store and
+// must be added again with addProducts.
+func (s *store) restock(ID productID, additional int) error {
+	if additional <= 0 {
+		return fmt.Errorf("%w: number of units to restock must be positive", ErrInvalidArgument)
+	}
+
+	var watchers []func()
+	defer func() { notifyStockWatchers(watchers) }()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	storeProduct, ok := s.products[ID]
+	if !ok {
+		for _, order := range s.processedOrders {
+			if lineIndex(order.products, ID) != -1 {
+				return fmt.Errorf("%w: product with ID %s has sold out and was removed from the store, add it again with addProducts", ErrProductNotFound, ID.String())
+			}
+		}
+		return fmt.Errorf("%w: product with ID %s does not exist", ErrProductNotFound, ID.String())
+	}
+
+	outOfStock := s.watchedOutOfStockLocked()
+	product := storeProduct.Product()
+	product.quantity += additional
+	s.touch(product)
+	watchers = s.backInStockLocked(outOfStock)
+
+	return nil
+}
+
+// lowStock returns the products with a quantity at or below threshold, sorted
+// by quantity from the lowest. Sold out products come first with a quantity of
+// zero. Products outside their availability window are included, as they still
+// have to be restocked.
+func (s *store) lowStock(threshold int) []Product {
+	if threshold < 0 {
+		return nil
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var products []Product
+	for _, product := range s.products {
+		if product.Quantity() <= threshold {
+			products = append(products, product)
+		}
+	}
+	products = append(products, s.soldOutProducts()...)
+
+	sort.SliceStable(products, func(i, j int) bool {
+		if qi, qj := products[i].Quantity(), products[j].Quantity(); qi != qj {
+			return qi < qj
+		}
+		iID, jID := products[i].ID(), products[j].ID()
+		return bytes.Compare(iID[:], jID[:]) < 0
+	})
+
+	return products
+}
+
+// soldOutProducts returns the products that have been sold and have no units
+// left in the store or in reservations. Products that were deleted while in
+// stock are not included. The lock must be held.
+func (s *store) soldOutProducts() []Product {
+	reserved := make(map[productID]bool)
+	for _, r := range s.reservations {
+		for _, line := range r.lines {
+			reserved[line.product.ID()] = true
+		}
+	}
+
+	var products []Product
+	seen := make(map[productID]bool)
+	for _, order := range s.processedOrders {
+		if order.status == OrderStatusCancelled {
+			continue
+		}
+
+		for _, line := range order.products {
+			ID := line.product.ID()
+			if _, inStock := s.products[ID]; inStock || reserved[ID] || seen[ID] || line.product.Quantity() != 0 {
+				continue
+			}
+
+			seen[ID] = true
+			products = append(products, line.product)
+		}
+	}
+
+	return products
+}
+
+// setMaxImages sets the maximum number of images a product added to or updated
+// in the store can have. Products already in the store are not changed.
+func (s *store) setMaxImages(maxImages int) error {
+	if maxImages <= 0 {
+		return fmt.Errorf("%w: maximum number of images must be positive", ErrInvalidArgument)
+	}
+
+	s.mtx.Lock()
+	s.maxImages = maxImages
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// setLowStockThreshold sets the quantity at or below which a sale publishes an
+// EventLowStock for a product. A negative threshold disables the event.
+func (s *store) setLowStockThreshold(threshold int) {
+	s.mtx.Lock()
+	s.lowStockThreshold = threshold
+	s.mtx.Unlock()
+}
+
+// inStock checks if the specified product type is in this store and
+// in stock. Products outside their availability window are not in stock.
+func (s *store) inStock(productType string) bool {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	now := s.now()
+	for _, product := range s.indexedProductsLocked(s.byType[productType]) {
+		if sellable(product, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inStockCount returns the number of units of the specified product type that
+// are in stock. Products outside their availability window are not counted.
+func (s *store) inStockCount(productType string) int {
+	s.releaseExpiredReservations()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var units int
+	now := s.now()
+	for _, product := range s.indexedProductsLocked(s.byType[productType]) {
+		if sellable(product, now) {
+			units += product.Quantity()
+		}
+	}
+
+	return units
+}
+
+// generateProductID generates a random non-zero ID that is not used by any
+// product in the store or its archive, or in pending. The write lock must be
+// held.
+func (s *store) generateProductID(pending map[productID]bool) (productID, error) {
+	var ID productID
+	for i := 0; i < maxIDGenerationAttempts; i++ {
+		if err := s.newID(ID[:]); err != nil {
+			return zeroProductID, err
+		}
+
+		_, inStock := s.products[ID]
+		_, archived := s.archived[ID]
+		if !ID.IsZero() && !inStock && !archived && !pending[ID] {
+			return ID, nil
+		}
+	}
+
+	return zeroProductID, fmt.Errorf("%w for a product", ErrIDGeneration)
+}
+
+// generateOrderID generates a random non-zero ID that is not used by any
+// processed order or in pending. The write lock must be held.
+func (s *store) generateOrderID(pending map[orderID]bool) (orderID, error) {
+	var ID orderID
+	for i := 0; i < maxIDGenerationAttempts; i++ {
+		if err := s.newID(ID[:]); err != nil {
+			return zeroOrderID, err
+		}
+
+		if _, exists := s.processedOrders[ID]; !ID.IsZero() && !exists && !pending[ID] {
+			return ID, nil
+		}
+	}
+
+	return zeroOrderID, fmt.Errorf("%w for an order", ErrIDGeneration)
+}
+
+// generateCustomerID generates a random non-zero ID that is not used by any
+// customer. The write lock must be held.
+func (s *store) generateCustomerID() (customerID, error) {
+	var ID customerID
+	for i := 0; i < maxIDGenerationAttempts; i++ {
+		if err := s.newID(ID[:]); err != nil {
+			return zeroCustomerID, err
+		}
+
+		if _, exists := s.customers[ID]; !ID.IsZero() && !exists {
+			return ID, nil
+		}
+	}
+
+	return zeroCustomerID, fmt.Errorf("%w for a customer", ErrIDGeneration)
+}
+
+// newID fills b with the bytes of a new ID from the store's ID generator.
+func (s *store) newID(b []byte) error {
+	if err := s.idGenerator.NewID(b); err != nil {
+		return fmt.Errorf("%w: %v", ErrIDGeneration, err)
 	}
+	return nil
 }
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkInvariants fails the test if the store is inconsistent.
+func checkInvariants(t testing.TB, s *store) {
+	t.Helper()
+	for _, err := range s.verifyInvariants() {
+		t.Errorf("invariant violated: %v", err)
+	}
+}
+
+func TestSellProductMaxOrderSubtotal(t *testing.T) {
+	s, buyer := testStore(t)
+	if err := s.setTaxRate(750); err != nil {
+		t.Fatalf("setTaxRate error: %v", err)
+	}
+	IDs := mustAddProducts(t, s, testProduct(t, "Gold Bar", maxPrice, 2002))
+	units := int(maxOrderSubtotal / maxPrice)
+
+	if _, err := s.sellProduct(testOrder(buyer, 2*maxOrderSubtotal, line(t, s, IDs[0], units+1))); !errors.Is(err, ErrInvalidOrder) {
+		t.Fatalf("expected ErrInvalidOrder for an order over maxOrderSubtotal, got %v", err)
+	}
+
+	// An order at the bound is charged the exact tax.
+	o := testOrder(buyer, 2*maxOrderSubtotal, line(t, s, IDs[0], units))
+	ID, err := s.sellProduct(o)
+	if err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+	if want := maxOrderSubtotal / 10000 * 750; o.taxAmount != want {
+		t.Fatalf("expected tax of %s, got %s", want, o.taxAmount)
+	}
+	if want := 2*maxOrderSubtotal - maxOrderSubtotal - o.taxAmount; o.changeDue != want {
+		t.Fatalf("expected change of %s, got %s", want, o.changeDue)
+	}
+
+	if err := s.addToOrder(ID, IDs[0]); !errors.Is(err, ErrInvalidOrder) {
+		t.Fatalf("expected ErrInvalidOrder adding to an order at maxOrderSubtotal, got %v", err)
+	}
+	if p := s.product(IDs[0]); p.Quantity() != 2002-units {
+		t.Fatalf("expected %d units left, got %d", 2002-units, p.Quantity())
+	}
+	checkInvariants(t, s)
+}
+
+func TestRefundOrderItemsDiscountedOrder(t *testing.T) {
+	s, buyer := testStore(t)
+	if err := s.setTaxRate(750); err != nil {
+		t.Fatalf("setTaxRate error: %v", err)
+	}
+	if err := s.addDiscount("SAVE10", Discount{Kind: DiscountPercentage, BasisPoints: 1000}); err != nil {
+		t.Fatalf("addDiscount error: %v", err)
+	}
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1), testProduct(t, "Beans", 3000, 1))
+
+	// Subtotal 40.00, less 4.00 off, plus 7.5% tax on 36.00 is 38.70.
+	o := testOrder(buyer, 5000, line(t, s, IDs[0], 1), line(t, s, IDs[1], 1))
+	o.discountCode = "SAVE10"
+	ID, err := s.sellProduct(o)
+	if err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+	if o.changeDue != 1130 {
+		t.Fatalf("expected change of 11.30, got %s", o.changeDue)
+	}
+
+	// Rice is a quarter of the subtotal, so a quarter of the 38.70 paid
+	// is refunded.
+	refunded, err := s.refundOrderItems(ID, IDs[0])
+	if err != nil {
+		t.Fatalf("refundOrderItems error: %v", err)
+	}
+	if refunded != 968 {
+		t.Fatalf("expected refund of 9.68, got %s", refunded)
+	}
+	checkInvariants(t, s)
+
+	// The last product refunded gets the rest of the payment.
+	refunded, err = s.refundOrderItems(ID, IDs[1])
+	if err != nil {
+		t.Fatalf("refundOrderItems error: %v", err)
+	}
+	if refunded != 2902 {
+		t.Fatalf("expected refund of 29.02, got %s", refunded)
+	}
+	if o.refundedAmount != 3870 || o.revenue() != 0 {
+		t.Fatalf("expected 38.70 refunded and no revenue, got %s refunded and %s revenue", o.refundedAmount, o.revenue())
+	}
+	checkInvariants(t, s)
+}
+
+func TestRefundOrderItemsFixedDiscount(t *testing.T) {
+	s, buyer := testStore(t)
+	if err := s.addDiscount("FLAT", Discount{Kind: DiscountFixed, Amount: 1500}); err != nil {
+		t.Fatalf("addDiscount error: %v", err)
+	}
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 2))
+
+	// Two units for 20.00 less 15.00 off costs 5.00.
+	o := testOrder(buyer, 500, line(t, s, IDs[0], 2))
+	o.discountCode = "FLAT"
+	ID, err := s.sellProduct(o)
+	if err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+
+	var total Money
+	for i := 0; i < 2; i++ {
+		refunded, err := s.refundOrderItems(ID, IDs[0])
+		if err != nil {
+			t.Fatalf("refundOrderItems error: %v", err)
+		}
+		if refunded > 1000 {
+			t.Fatalf("refunded %s for a unit that cost at most 5.00", refunded)
+		}
+		total = total.Add(refunded)
+	}
+
+	if total != 500 {
+		t.Fatalf("expected the 5.00 paid to be refunded, got %s", total)
+	}
+	if o.revenue() < 0 {
+		t.Fatalf("revenue is negative: %s", o.revenue())
+	}
+	checkInvariants(t, s)
+}
+
+func TestValidateOrderExpiredReservation(t *testing.T) {
+	s, buyer := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1))
+	if _, err := s.reserve(time.Minute, IDs[0]); err != nil {
+		t.Fatalf("reserve error: %v", err)
+	}
+
+	var events int
+	s.subscribe(func(StoreEvent) { events++ })
+
+	o := testOrder(buyer, 1000, orderLine{product: &product{id: IDs[0]}, quantity: 1})
+	if _, err := s.validateOrder(o); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("expected ErrProductNotFound for a reserved product, got %v", err)
+	}
+
+	// The units of an expired reservation can be sold, but validating the
+	// order must not release them.
+	clock.advance(time.Minute)
+	total, err := s.validateOrder(o)
+	if err != nil {
+		t.Fatalf("validateOrder error: %v", err)
+	}
+	if total != 1000 {
+		t.Fatalf("expected total of 10.00, got %s", total)
+	}
+	if len(s.reservations) != 1 || s.product(IDs[0]) != nil || events != 0 {
+		t.Fatalf("validateOrder changed the store")
+	}
+
+	if _, err := s.sellProduct(o); err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+	if len(s.reservations) != 0 {
+		t.Fatalf("sellProduct did not release the expired reservation")
+	}
+	checkInvariants(t, s)
+}
+
+func TestAvailabilityWindow(t *testing.T) {
+	s, buyer := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	from, until := clock.Now().Add(time.Hour), clock.Now().Add(2*time.Hour)
+	IDs := mustAddProducts(t, s,
+		testProduct(t, "Rice", 1000, 5, WithCategory("Food"), WithTags("grain")),
+		testProduct(t, "Seasonal Beans", 3000, 5, WithCategory("Food"), WithTags("grain"), WithAvailabilityWindow(&from, &until)),
+	)
+	seasonal := IDs[1]
+
+	// queries returns the number of available products every query finds.
+	queries := map[string]func() int{
+		"availableProducts":   func() int { products, _ := s.availableProducts("test"); return len(products) },
+		"availableProductIDs": func() int { return len(s.availableProductIDs("test")) },
+		"availableProductsInPriceRange": func() int {
+			products, _ := s.availableProductsInPriceRange("test", 0, 0)
+			return len(products)
+		},
+		"availableProductsByCategory": func() int { products, _ := s.availableProductsByCategory("food"); return len(products) },
+		"searchProducts":              func() int { return len(s.searchProducts("", false, false)) },
+		"filterProducts":              func() int { products, _ := s.filterProducts(ByType("test")); return len(products) },
+		"fuzzySearch":                 func() int { return len(s.fuzzySearch("rice", 10)) },
+		"productsByTag":               func() int { return len(s.productsByTag("grain")) },
+		"forEachProduct": func() int {
+			var n int
+			s.forEachProduct(func(Product) bool { n++; return true })
+			return n
+		},
+	}
+	checkQueries := func(when string, want int) {
+		t.Helper()
+		for name, query := range queries {
+			if got := query(); got != want {
+				t.Errorf("%s %s: expected %d product(s), got %d", name, when, want, got)
+			}
+		}
+	}
+
+	// sell tries to sell and add to an order a unit of the seasonal product.
+	sell := func() (orderErr, addErr error) {
+		o := testOrder(buyer, 10000, line(t, s, seasonal, 1))
+		if _, orderErr = s.validateOrder(o); orderErr == nil {
+			_, orderErr = s.sellProduct(o)
+		}
+
+		pending := testOrder(buyer, 10000, line(t, s, IDs[0], 1))
+		ID, err := s.sellProduct(pending)
+		if err != nil {
+			t.Fatalf("sellProduct error: %v", err)
+		}
+		return orderErr, s.addToOrder(ID, seasonal)
+	}
+
+	checkQueries("before the window opens", 1)
+	if orderErr, addErr := sell(); !errors.Is(orderErr, ErrProductUnavailable) || !errors.Is(addErr, ErrProductUnavailable) {
+		t.Fatalf("expected ErrProductUnavailable before the window opens, got %v and %v", orderErr, addErr)
+	}
+
+	clock.advance(time.Hour)
+	checkQueries("in the window", 2)
+	if orderErr, addErr := sell(); orderErr != nil || addErr != nil {
+		t.Fatalf("expected the product to sell in the window, got %v and %v", orderErr, addErr)
+	}
+
+	clock.advance(time.Hour)
+	checkQueries("after the window closes", 1)
+	if orderErr, addErr := sell(); !errors.Is(orderErr, ErrProductUnavailable) || !errors.Is(addErr, ErrProductUnavailable) {
+		t.Fatalf("expected ErrProductUnavailable after the window closes, got %v and %v", orderErr, addErr)
+	}
+	checkInvariants(t, s)
+}
+
+func TestReportsApplyAvailabilityWindow(t *testing.T) {
+	s, _ := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	from, until := clock.Now().Add(time.Hour), clock.Now().Add(2*time.Hour)
+	IDs := mustAddProducts(t, s,
+		testProduct(t, "Rice", 1000, 5),
+		testProduct(t, "Seasonal Beans", 3000, 5, WithAvailabilityWindow(&from, &until)),
+	)
+
+	checkReports := func(when string, wantProducts, wantUnits int, wantValue Money) {
+		t.Helper()
+		if report := s.inventoryReport(); report.AvailableCount != wantUnits || report.AvailableValue != wantValue {
+			t.Errorf("inventoryReport %s: expected %d units worth %s, got %d worth %s", when, wantUnits, wantValue.Format(), report.AvailableCount, report.AvailableValue.Format())
+		}
+		if stats := s.priceStats(""); stats.Count != wantProducts {
+			t.Errorf("priceStats %s: expected %d product(s), got %d", when, wantProducts, stats.Count)
+		}
+
+		var csv strings.Builder
+		if err := s.ExportCSV(&csv); err != nil {
+			t.Fatalf("ExportCSV error: %v", err)
+		}
+		if rows := strings.Count(csv.String(), "\n") - 1; rows != wantProducts {
+			t.Errorf("ExportCSV %s: expected %d row(s), got %d", when, wantProducts, rows)
+		}
+
+		var metrics strings.Builder
+		if err := s.WritePrometheus(&metrics); err != nil {
+			t.Fatalf("WritePrometheus error: %v", err)
+		}
+		if gauge := fmt.Sprintf("gstore_available_units{type=\"test\"} %d\n", wantUnits); !strings.Contains(metrics.String(), gauge) {
+			t.Errorf("WritePrometheus %s: expected %q in\n%s", when, gauge, metrics.String())
+		}
+
+		// Restocking queries include products outside their window.
+		if products := s.lowStock(5); len(products) != 2 {
+			t.Errorf("lowStock %s: expected 2 products, got %d", when, len(products))
+		}
+	}
+
+	checkReports("before the window opens", 1, 5, 5000)
+	clock.advance(time.Hour)
+	checkReports("in the window", 2, 10, 20000)
+	clock.advance(time.Hour)
+	checkReports("after the window closes", 1, 5, 5000)
+
+	if s.product(IDs[1]) == nil {
+		t.Fatalf("product outside its availability window was removed")
+	}
+}
+
+func TestAddProductsNormalizesName(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "  Ford  Ecosport ", 1000, 1))
+	if got := s.product(IDs[0]).DisplayName(); got != "Ford Ecosport" {
+		t.Fatalf("expected name %q, got %q", "Ford Ecosport", got)
+	}
+
+	if _, err := s.addProducts(testProduct(t, "   ", 1000, 1)); err == nil {
+		t.Fatalf("added a product with a blank name")
+	}
+}
+
+func TestSellProductPaymentMethod(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 10))
+
+	var o *order
+	for _, method := range []PaymentMethod{PaymentMethodCard, PaymentMethodTransfer, PaymentMethod(-1)} {
+		o = testOrder(buyer, 5000, line(t, s, IDs[0], 1))
+		o.paymentMethod = method
+		if _, err := s.sellProduct(o); err != nil {
+			if method.isValid() || !errors.Is(err, ErrInvalidOrder) {
+				t.Fatalf("sellProduct with payment method %s error: %v", method, err)
+			}
+			continue
+		}
+		if !method.isValid() {
+			t.Fatalf("sellProduct accepted unknown payment method %s", method)
+		}
+	}
+
+	// An order that does not set a payment method is paid in cash.
+	o = testOrder(buyer, 6000, line(t, s, IDs[0], 1))
+	if _, err := s.sellProduct(o); err != nil {
+		t.Fatalf("sellProduct error: %v", err)
+	}
+	if o.PaymentMethod() != PaymentMethodCash {
+		t.Fatalf("payment method of order without one is %s, want cash", o.PaymentMethod())
+	}
+
+	want := map[PaymentMethod]Money{
+		PaymentMethodCash:     5000,
+		PaymentMethodCard:     5000,
+		PaymentMethodTransfer: 5000,
+	}
+	got := s.revenueByPaymentMethod()
+	if len(got) != len(want) {
+		t.Fatalf("revenueByPaymentMethod = %v, want %v", got, want)
+	}
+	for method, revenue := range want {
+		if got[method] != revenue {
+			t.Fatalf("revenueByPaymentMethod = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSellProductConcurrentSharedProducts(t *testing.T) {
+	const stock, buyers = 5, 20
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, stock), testProduct(t, "Beans", 3000, stock))
+
+	var wg sync.WaitGroup
+	var sold atomic.Int64
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := testOrder(buyer, 8000,
+				orderLine{product: &product{id: IDs[0]}, quantity: 1},
+				orderLine{product: &product{id: IDs[1]}, quantity: 1})
+			_, err := s.sellProduct(o)
+			switch {
+			case err == nil:
+				sold.Add(1)
+			case !errors.Is(err, ErrOutOfStock) && !errors.Is(err, ErrProductNotFound):
+				t.Errorf("sellProduct error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sold.Load() != stock {
+		t.Fatalf("%d orders were sold, want %d", sold.Load(), stock)
+	}
+	orders, _, _ := s.orders()
+	if len(orders) != stock {
+		t.Fatalf("store has %d orders, want %d", len(orders), stock)
+	}
+	for _, ID := range IDs {
+		if s.product(ID) != nil {
+			t.Fatalf("sold out product %s is still in the store", ID.String())
+		}
+	}
+	checkInvariants(t, s)
+}
+
+func TestSellProductMissingProductLeavesStoreUnchanged(t *testing.T) {
+	s, buyer := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 1))
+	missing := productID{1}
+
+	o := testOrder(buyer, 10000, line(t, s, IDs[0], 1), orderLine{product: &product{id: missing}, quantity: 1})
+	_, err := s.sellProduct(o)
+	if !errors.Is(err, ErrProductNotFound) || !strings.Contains(err.Error(), missing.String()) {
+		t.Fatalf("sellProduct error = %v, want ErrProductNotFound naming %s", err, missing.String())
+	}
+	if p := s.product(IDs[0]); p == nil || p.Quantity() != 1 {
+		t.Fatalf("product was changed by a failed sale: %v", p)
+	}
+	if orders, _, _ := s.orders(); len(orders) != 0 {
+		t.Fatalf("failed sale recorded %d orders", len(orders))
+	}
+}
+
+func TestMutationsBumpLastUpdated(t *testing.T) {
+	s, buyer := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 10))
+
+	mutations := []struct {
+		name   string
+		mutate func() error
+	}{
+		{"updateProduct", func() error {
+			return s.updateProduct(IDs[0], func(p *product) error {
+				p.description = "A bigger bag of rice."
+				return nil
+			})
+		}},
+		{"restock", func() error {
+			return s.restock(IDs[0], 5)
+		}},
+		{"sellProduct", func() error {
+			_, err := s.sellProduct(testOrder(buyer, 5000, line(t, s, IDs[0], 1)))
+			return err
+		}},
+	}
+
+	last := *s.product(IDs[0]).Product().LastUpdated()
+	if !last.Equal(clock.Now()) {
+		t.Fatalf("last updated date after addProducts is %v, want %v", last, clock.Now())
+	}
+	for _, m := range mutations {
+		clock.advance(time.Minute)
+		if err := m.mutate(); err != nil {
+			t.Fatalf("%s error: %v", m.name, err)
+		}
+
+		s.mtx.RLock()
+		updated := *s.products[IDs[0]].Product().LastUpdated()
+		s.mtx.RUnlock()
+		if !updated.After(last) || !updated.Equal(clock.Now()) {
+			t.Fatalf("last updated date after %s is %v, want %v", m.name, updated, clock.Now())
+		}
+		last = updated
+	}
+}
+
+func TestUpdateProductRejectsInvalidPrice(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 5000, 2))
+
+	for _, price := range []Money{-1, 0, maxPrice + 1} {
+		err := s.updateProduct(IDs[0], func(p *product) error {
+			p.price = price
+			return nil
+		})
+		if !errors.Is(err, ErrInvalidProduct) {
+			t.Fatalf("updateProduct to price %d error = %v, want ErrInvalidProduct", int64(price), err)
+		}
+	}
+
+	if p := s.product(IDs[0]); p.Price() != 5000 {
+		t.Fatalf("price after rejected updates is %s, want 50.00", p.Price())
+	}
+	if _, total := s.availableProducts(""); total != 10000 {
+		t.Fatalf("total cost of available products is %s, want 100.00", total)
+	}
+}
+
+func TestDuplicateProductDeepCopies(t *testing.T) {
+	s, _ := testStore(t)
+	original, err := newCar("Ford Ecosport", "car",
+		WithPrice(1_000_000), WithQuantity(1), WithDescription("A compact SUV."),
+		WithImages("https://example.com/ecosport.png"),
+		WithSpecifications(map[string][]string{"engine": {"1.5L"}, "seats": {"5"}}),
+		WithMake("Ford"), WithModel("Ecosport"), WithColor("Blue"), WithYear("2020"))
+	if err != nil {
+		t.Fatalf("newCar error: %v", err)
+	}
+	ID := mustAddProducts(t, s, original)[0]
+
+	copyID, err := s.duplicateProduct(ID, func(p Product) {
+		c := p.(*car)
+		c.color = "Red"
+		c.images[0] = "https://example.com/ecosport-red.png"
+		c.specifications["engine"][0] = "2.0L"
+		c.specifications["seats"] = append(c.specifications["seats"], "7")
+		c.specifications["trim"] = []string{"Titanium"}
+	})
+	if err != nil {
+		t.Fatalf("duplicateProduct error: %v", err)
+	}
+	if copyID == ID {
+		t.Fatal("duplicate has the ID of the original")
+	}
+
+	stored := s.product(ID).(*car)
+	if stored.color != "Blue" || stored.images[0] != "https://example.com/ecosport.png" {
+		t.Fatalf("original was changed by the duplicate: color %q, images %v", stored.color, stored.images)
+	}
+	wantSpecs := map[string][]string{"engine": {"1.5L"}, "seats": {"5"}}
+	if !reflect.DeepEqual(stored.specifications, wantSpecs) {
+		t.Fatalf("original specifications are %v, want %v", stored.specifications, wantSpecs)
+	}
+
+	duplicate := s.product(copyID).(*car)
+	wantSpecs = map[string][]string{"engine": {"2.0L"}, "seats": {"5", "7"}, "trim": {"Titanium"}}
+	if duplicate.color != "Red" || duplicate.make != "Ford" || !reflect.DeepEqual(duplicate.specifications, wantSpecs) {
+		t.Fatalf("duplicate is %q with specifications %v, want Red with %v", duplicate.color, duplicate.specifications, wantSpecs)
+	}
+}
+
+func TestAddProductsCopiesProducts(t *testing.T) {
+	s, _ := testStore(t)
+	p := testProduct(t, "Rice", 5000, 2)
+	c, err := newCar("Ford Ecosport", "car",
+		WithPrice(1_000_000), WithQuantity(1), WithDescription("A compact SUV."),
+		WithImages("https://example.com/ecosport.png"),
+		WithSpecifications(map[string][]string{"engine": {"1.5L"}}),
+		WithMake("Ford"), WithModel("Ecosport"), WithColor("Blue"), WithYear("2020"))
+	if err != nil {
+		t.Fatalf("newCar error: %v", err)
+	}
+	IDs := mustAddProducts(t, s, p, c)
+
+	p.images[0] = "https://example.com/beans.png"
+	p.images = append(p.images, "https://example.com/more.png")
+	p.specifications["size"][0] = "XL"
+	p.specifications["weight"] = []string{"50kg"}
+	p.quantity = 100
+	c.color = "Red"
+	c.product.specifications["engine"][0] = "2.0L"
+	c.product.price = 1
+
+	stored := s.product(IDs[0]).Product()
+	if stored == p || !reflect.DeepEqual(stored.images, []string{"https://example.com/product.png"}) ||
+		!reflect.DeepEqual(stored.specifications, map[string][]string{"size": {"M"}}) || stored.quantity != 2 {
+		t.Fatalf("stored product changed with the original: images %v, specifications %v, quantity %d",
+			stored.images, stored.specifications, stored.quantity)
+	}
+
+	storedCar := s.product(IDs[1]).(*car)
+	if storedCar == c || storedCar.product == c.product || storedCar.color != "Blue" || storedCar.price != 1_000_000 ||
+		!reflect.DeepEqual(storedCar.specifications, map[string][]string{"engine": {"1.5L"}}) {
+		t.Fatalf("stored car changed with the original: color %q, price %s, specifications %v",
+			storedCar.color, storedCar.price, storedCar.specifications)
+	}
+}
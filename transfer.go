@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// storeSeq numbers stores in the order they are created, so that stores
+// locked together are always locked in the same order.
+var storeSeq atomic.Uint64
+
+// lockStores locks the write locks of two different stores in the order they
+// were created, so two calls locking the same stores cannot deadlock. It
+// returns a function that unlocks both stores.
+func lockStores(a, b *store) (unlock func()) {
+	first, second := a, b
+	if b.seq < a.seq {
+		first, second = b, a
+	}
+
+	first.mtx.Lock()
+	second.mtx.Lock()
+	return func() {
+		second.mtx.Unlock()
+		first.mtx.Unlock()
+	}
+}
+
+// transferTo moves all the units in stock of the products with the specified
+// IDs from the store to other, keeping their IDs. Either all the products are
+// moved or none are. Units that are reserved or were sold stay with the
+// store.
+func (s *store) transferTo(other *store, productIDs ...productID) error {
+	if other == nil || other == s {
+		return fmt.Errorf("%w: provide another store to transfer products to", ErrInvalidArgument)
+	}
+
+	if len(productIDs) == 0 {
+		return ErrNoProductIDs
+	}
+
+	// The events of each store are published after both are unlocked.
+	var deletedEvent, addedEvent *StoreEvent
+	var watchers []func()
+	defer func() {
+		s.publish(deletedEvent)
+		other.publish(addedEvent)
+		notifyStockWatchers(watchers)
+	}()
+
+	unlock := lockStores(s, other)
+	defer unlock()
+
+	// Check every product before moving any of them, so a failure does not
+	// leave the products split between the stores.
+	transferIDs := make([]productID, 0, len(productIDs))
+	seen := make(map[productID]bool, len(productIDs))
+	for _, ID := range productIDs {
+		if seen[ID] {
+			continue
+		}
+		seen[ID] = true
+
+		p, ok := s.products[ID]
+		if !ok {
+			return fmt.Errorf("%w: product with ID %s does not exist", ErrProductNotFound, ID.String())
+		}
+
+		_, inStock := other.products[ID]
+		_, archived := other.archived[ID]
+		if inStock || archived {
+			return fmt.Errorf("%w: product with ID %s already exists in %s", ErrInvalidProduct, ID.String(), other.name)
+		}
+
+		if p.Currency() != other.currency {
+			return fmt.Errorf("%w: product with ID %s is priced in %s but %s only sells in %s", ErrInvalidProduct, ID.String(), p.Currency(), other.name, other.currency)
+		}
+
+		if !other.sellsTypeLocked(p.Type()) {
+			return fmt.Errorf("%w %q: %s does not sell product with ID %s", ErrUnknownProductType, p.Type(), other.name, ID.String())
+		}
+
+		if len(p.Images()) > other.maxImages {
+			return fmt.Errorf("%w: product with ID %s has %d images but at most %d are allowed in %s", ErrInvalidProduct, ID.String(), len(p.Images()), other.maxImages, other.name)
+		}
+
+		transferIDs = append(transferIDs, ID)
+	}
+
+	outOfStock := other.watchedOutOfStockLocked()
+	for _, ID := range transferIDs {
+		// Move a copy of the product, as the store's orders and
+		// reservations may still share the original.
+		p := copyProduct(s.products[ID])
+		other.touch(p.Product())
+		other.putProductLocked(p)
+		s.removeProductLocked(ID)
+	}
+
+	deletedEvent = &StoreEvent{Kind: EventProductsDeleted, ProductIDs: transferIDs}
+	addedEvent = &StoreEvent{Kind: EventProductsAdded, ProductIDs: append([]productID(nil), transferIDs...)}
+	watchers = other.backInStockLocked(outOfStock)
+
+	return nil
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -18,25 +24,367 @@ type (
 		// DisplayName returns the display name of the product.
 		DisplayName() string
 		// Price returns the price of the product.
-		Price() float64
-		// Display prints information about product.
-		Display()
+		Price() Money
+		// Currency returns the currency the price of the product is
+		// denominated in.
+		Currency() Currency
+		// Quantity returns the number of units of the product in stock.
+		Quantity() int
+		// Display writes information about product to w.
+		Display(w io.Writer)
+		// DisplayWith is like Display but prices are formatted with
+		// format.
+		DisplayWith(w io.Writer, format PriceFormatter)
 		// Images returns a list of image urls of the product.
 		Images() []string
+		// PrimaryImage returns the url of the image shown as the
+		// thumbnail of the product.
+		PrimaryImage() string
 		// IsValid checks if a product is valid and returns true if it is valid.
 		IsValid() bool
+		// Validate returns an error for every constraint the product does not
+		// satisfy. A valid product has no errors.
+		Validate() []error
+	}
+
+	// customer is a buyer in a store.
+	customer struct {
+		id    customerID
+		name  string
+		email string
+		phone string
 	}
 
 	// order is a buy request from a buyer.
 	order struct {
 		id              orderID
-		name            string
-		amountPaid      float64
+		customerID      customerID
+		amountPaid      Money
 		shippingAddress string
-		products        []Product
+		products        []orderLine
+		status          OrderStatus
+		// refundedProducts are products that were removed from the order
+		// and returned to the store, and refundedAmount is what the customer
+		// was paid back for them.
+		refundedProducts []orderLine
+		refundedAmount   Money
+		// discountCode is the code of the discount used for the order, and
+		// discountAmount is how much it took off the order cost.
+		discountCode   string
+		discountAmount Money
+		// taxAmount is the tax charged on the order.
+		taxAmount Money
+		// reservationID is the ID of the reservation holding the products
+		// of the order, if any.
+		reservationID reservationID
+		// placedAt is when the order was processed by the store.
+		placedAt *time.Time
+		// changeDue is how much more than the order total the customer
+		// paid, and balanceDue is how much less they paid after products
+		// were added to the order.
+		changeDue  Money
+		balanceDue Money
+		// notes are comments added to the order by staff, from the
+		// earliest.
+		notes []orderNote
+		// paymentMethod is how the customer paid for the order. The zero
+		// value is PaymentMethodCash, so orders that do not set a payment
+		// method are recorded as paid in cash.
+		paymentMethod PaymentMethod
+	}
+
+	// orderLine is a number of units of a single product in an order.
+	orderLine struct {
+		product  Product
+		quantity int
+		// price is the unit price the product was sold at. It is zero for
+		// lines that have not been sold, which cost the current price of
+		// the product.
+		price Money
+	}
+
+	// orderNote is a comment added to an order by staff, such as a
+	// delivery instruction from the customer.
+	orderNote struct {
+		author    string
+		text      string
+		createdAt time.Time
 	}
 )
 
+// PlacedAt returns when the order was placed.
+func (o *order) PlacedAt() *time.Time {
+	return o.placedAt
+}
+
+// PaymentMethod returns how the customer paid for the order.
+func (o *order) PaymentMethod() PaymentMethod {
+	return o.paymentMethod
+}
+
+// Notes returns a copy of the notes added to the order, from the earliest.
+func (o *order) Notes() []orderNote {
+	return append([]orderNote(nil), o.notes...)
+}
+
+// ChangeDue returns how much more than the order total the customer paid.
+func (o *order) ChangeDue() Money {
+	return o.changeDue
+}
+
+// BalanceDue returns how much less than the order total the customer has paid.
+func (o *order) BalanceDue() Money {
+	return o.balanceDue
+}
+
+// revenue returns the amount paid for the order less change and refunds.
+func (o *order) revenue() Money {
+	return o.amountPaid.Sub(o.changeDue).Sub(o.refundedAmount)
+}
+
+// subtotal returns the cost of the products of the order, including refunded
+// products, before the discount and tax.
+func (o *order) subtotal() Money {
+	var subtotal Money
+	for _, lines := range [][]orderLine{o.products, o.refundedProducts} {
+		for _, line := range lines {
+			subtotal = subtotal.Add(line.cost())
+		}
+	}
+	return subtotal
+}
+
+// sortOrders sorts orders in place from the earliest placed. Orders placed at
+// the same time are sorted by ID.
+func sortOrders(orders []*order) {
+	sort.SliceStable(orders, func(i, j int) bool {
+		if c := compareTimes(orders[i].placedAt, orders[j].placedAt); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(orders[i].id[:], orders[j].id[:]) < 0
+	})
+}
+
+// unitPrice returns the price of a single unit in the order line.
+func (ol orderLine) unitPrice() Money {
+	if ol.price != 0 {
+		return ol.price
+	}
+	return ol.product.Price()
+}
+
+// cost returns the total price of all units in the order line.
+func (ol orderLine) cost() Money {
+	return ol.unitPrice().Mul(int64(ol.quantity))
+}
+
+// lineIndex returns the index of the order line for the product with the
+// specified ID, or -1 if there is none.
+func lineIndex(lines []orderLine, ID productID) int {
+	for i, line := range lines {
+		if line.product.ID() == ID {
+			return i
+		}
+	}
+	return -1
+}
+
+// unitLineIndex returns the index of the first order line for the product
+// with the specified ID that has units left, or -1 if there is none. An order
+// can have more than one line for a product sold at different prices.
+func unitLineIndex(lines []orderLine, ID productID) int {
+	for i, line := range lines {
+		if line.product.ID() == ID && line.quantity > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// OrderStatus is the fulfillment status of an order.
+type OrderStatus int
+
+// These are the supported order statuses. An order starts as pending, and can
+// be shipped and then delivered, or cancelled before it is delivered.
+const (
+	OrderStatusPending OrderStatus = iota
+	OrderStatusShipped
+	OrderStatusDelivered
+	OrderStatusCancelled
+)
+
+var orderStatusNames = map[OrderStatus]string{
+	OrderStatusPending:   "pending",
+	OrderStatusShipped:   "shipped",
+	OrderStatusDelivered: "delivered",
+	OrderStatusCancelled: "cancelled",
+}
+
+func (os OrderStatus) String() string {
+	if name, ok := orderStatusNames[os]; ok {
+		return name
+	}
+	return fmt.Sprintf("OrderStatus(%d)", int(os))
+}
+
+// MarshalText implements encoding.TextMarshaler for OrderStatus.
+func (os OrderStatus) MarshalText() ([]byte, error) {
+	if _, ok := orderStatusNames[os]; !ok {
+		return nil, fmt.Errorf("unknown order status %d", int(os))
+	}
+	return []byte(os.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for OrderStatus.
+func (os *OrderStatus) UnmarshalText(text []byte) error {
+	for status, name := range orderStatusNames {
+		if name == string(text) {
+			*os = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown order status %q", string(text))
+}
+
+// PaymentMethod is how a customer paid for an order.
+type PaymentMethod int
+
+// These are the supported payment methods. Orders are paid in cash unless
+// another payment method is set.
+const (
+	PaymentMethodCash PaymentMethod = iota
+	PaymentMethodCard
+	PaymentMethodTransfer
+)
+
+var paymentMethodNames = map[PaymentMethod]string{
+	PaymentMethodCash:     "cash",
+	PaymentMethodCard:     "card",
+	PaymentMethodTransfer: "transfer",
+}
+
+func (pm PaymentMethod) String() string {
+	if name, ok := paymentMethodNames[pm]; ok {
+		return name
+	}
+	return fmt.Sprintf("PaymentMethod(%d)", int(pm))
+}
+
+// isValid checks if pm is a supported payment method.
+func (pm PaymentMethod) isValid() bool {
+	_, ok := paymentMethodNames[pm]
+	return ok
+}
+
+// MarshalText implements encoding.TextMarshaler for PaymentMethod.
+func (pm PaymentMethod) MarshalText() ([]byte, error) {
+	if !pm.isValid() {
+		return nil, fmt.Errorf("unknown payment method %d", int(pm))
+	}
+	return []byte(pm.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for PaymentMethod.
+func (pm *PaymentMethod) UnmarshalText(text []byte) error {
+	for method, name := range paymentMethodNames {
+		if name == string(text) {
+			*pm = method
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown payment method %q", string(text))
+}
+
+// canTransitionTo checks if an order with this status can be moved to the
+// next status.
+func (os OrderStatus) canTransitionTo(next OrderStatus) bool {
+	switch os {
+	case OrderStatusPending:
+		return next == OrderStatusShipped || next == OrderStatusCancelled
+	case OrderStatusShipped:
+		return next == OrderStatusDelivered || next == OrderStatusCancelled
+	default:
+		return false
+	}
+}
+
+// Currency is the ISO 4217 code of the currency prices are denominated in.
+type Currency string
+
+// These are some of the currencies a store can sell products in.
+const (
+	CurrencyNGN Currency = "NGN"
+	CurrencyUSD Currency = "USD"
+	CurrencyGBP Currency = "GBP"
+	CurrencyEUR Currency = "EUR"
+)
+
+// SortOption is the order in which a list of products is sorted.
+type SortOption int
+
+// These are the supported product sort options. Products that compare equal
+// are sorted by ID, so the order is always deterministic.
+const (
+	SortByPriceAsc SortOption = iota
+	SortByPriceDesc
+	SortByName
+	SortByCreatedAt
+)
+
+// sortProducts sorts products in place using the specified sort option.
+func sortProducts(products []Product, option SortOption) {
+	compare := func(a, b Product) int {
+		switch option {
+		case SortByPriceAsc:
+			return compareMoney(a.Price(), b.Price())
+		case SortByPriceDesc:
+			return compareMoney(b.Price(), a.Price())
+		case SortByName:
+			return strings.Compare(a.DisplayName(), b.DisplayName())
+		case SortByCreatedAt:
+			return compareTimes(a.Product().createdAt, b.Product().createdAt)
+		}
+		return 0
+	}
+
+	sort.SliceStable(products, func(i, j int) bool {
+		if c := compare(products[i], products[j]); c != 0 {
+			return c < 0
+		}
+		iID, jID := products[i].ID(), products[j].ID()
+		return bytes.Compare(iID[:], jID[:]) < 0
+	})
+}
+
+// compareMoney returns -1 if a < b, 1 if a > b and 0 otherwise.
+func compareMoney(a, b Money) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareTimes returns -1 if a is before b, 1 if a is after b and 0 otherwise.
+// A nil time is before any non-nil time.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	}
+	return 0
+}
+
 // productID is the unique ID of a product.
 type productID [16]byte
 
@@ -50,6 +398,29 @@ func (pi productID) IsZero() bool {
 	return pi == zeroProductID
 }
 
+// MarshalText implements encoding.TextMarshaler for productID, so productIDs are
+// encoded in JSON as hex strings.
+func (pi productID) MarshalText() ([]byte, error) {
+	return []byte(pi.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for productID.
+func (pi *productID) UnmarshalText(text []byte) error {
+	if pi == nil {
+		return errors.New("nil productID")
+	}
+	return decodeID(pi[:], string(text))
+}
+
+// parseProductID returns the productID encoded in s as a hex string.
+func parseProductID(s string) (productID, error) {
+	var ID productID
+	if err := decodeID(ID[:], s); err != nil {
+		return zeroProductID, fmt.Errorf("invalid product ID %q: %w", s, err)
+	}
+	return ID, nil
+}
+
 // orderID is the unique ID of an order.
 type orderID [12]byte
 
@@ -63,18 +434,99 @@ func (oi orderID) IsZero() bool {
 	return oi == zeroOrderID
 }
 
+// MarshalText implements encoding.TextMarshaler for orderID, so orderIDs are
+// encoded in JSON as hex strings.
+func (oi orderID) MarshalText() ([]byte, error) {
+	return []byte(oi.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for orderID.
+func (oi *orderID) UnmarshalText(text []byte) error {
+	if oi == nil {
+		return errors.New("nil orderID")
+	}
+	return decodeID(oi[:], string(text))
+}
+
+// parseOrderID returns the orderID encoded in s as a hex string.
+func parseOrderID(s string) (orderID, error) {
+	var ID orderID
+	if err := decodeID(ID[:], s); err != nil {
+		return zeroOrderID, fmt.Errorf("invalid order ID %q: %w", s, err)
+	}
+	return ID, nil
+}
+
+// customerID is the unique ID of a customer.
+type customerID [12]byte
+
+var zeroCustomerID customerID
+
+func (ci customerID) String() string {
+	return hex.EncodeToString(ci[:])
+}
+
+func (ci customerID) IsZero() bool {
+	return ci == zeroCustomerID
+}
+
+// MarshalText implements encoding.TextMarshaler for customerID, so customerIDs are
+// encoded in JSON as hex strings.
+func (ci customerID) MarshalText() ([]byte, error) {
+	return []byte(ci.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for customerID.
+func (ci *customerID) UnmarshalText(text []byte) error {
+	if ci == nil {
+		return errors.New("nil customerID")
+	}
+	return decodeID(ci[:], string(text))
+}
+
+// IsValid checks if a customer is valid and returns true if it is valid.
+func (c *customer) IsValid() bool {
+	return c != nil && c.name != "" && strings.Contains(c.email, "@")
+}
+
 // product implements the Product interface.
 type product struct {
 	id             productID
 	name           string
-	price          float64
+	price          Money
+	currency       Currency
+	quantity       int
 	productType    string
 	category       string
 	description    string
 	images         []string
 	specifications map[string][]string
-	lastUpdated    *time.Time
-	createdAt      *time.Time
+	// metadata holds custom fields of the product, such as the warranty
+	// length or VIN. It is not required for the product to be valid.
+	metadata map[string]string
+	// parentID is the ID of the product this product is a variant of, or
+	// zero if it is not a variant.
+	parentID productID
+	// costPrice is what the store paid for a unit of the product. It is
+	// zero if the cost price is not known.
+	costPrice   Money
+	lastUpdated *time.Time
+	createdAt   *time.Time
+	// deletedAt is when the product was deleted from the store, if it
+	// has been.
+	deletedAt *time.Time
+	// reorderLevel is the quantity at or below which more units of the
+	// product should be ordered, and reorderQuantity is how many. The
+	// product has no reorder policy if reorderQuantity is zero.
+	reorderLevel    int
+	reorderQuantity int
+	// tags classify the product under any number of themes, such as
+	// "family" or "luxury". They are lowercase and unique.
+	tags []string
+	// availableFrom and availableUntil are when the product can start and
+	// stop being sold, if it can only be sold within a window.
+	availableFrom  *time.Time
+	availableUntil *time.Time
 }
 
 // ID returns the unique ID of the product.
@@ -103,38 +555,254 @@ func (p *product) Description() string {
 }
 
 // Price returns the price of the product.
-func (p *product) Price() float64 {
+func (p *product) Price() Money {
 	return p.price
 }
 
+// Currency returns the currency the price of the product is denominated in.
+func (p *product) Currency() Currency {
+	return p.currency
+}
+
+// Quantity returns the number of units of the product in stock.
+func (p *product) Quantity() int {
+	return p.quantity
+}
+
 // Category returns the category of the product.
 func (p *product) Category() string {
 	return p.category
 }
 
-// Display prints information about the product.
-func (p *product) Display() {
-	fmt.Println("Name: ", p.name)
-	fmt.Println("Description: ", p.description)
-	fmt.Println("Price: ", p.price)
-	fmt.Println("Specifications:")
+// Display writes information about the product to w.
+func (p *product) Display(w io.Writer) {
+	p.DisplayWith(w, defaultPriceFormatter)
+}
+
+// DisplayWith is like Display but prices are formatted with format.
+func (p *product) DisplayWith(w io.Writer, format PriceFormatter) {
+	fmt.Fprintln(w, "Name: ", p.name)
+	fmt.Fprintln(w, "Description: ", p.description)
+	fmt.Fprintln(w, "Price: ", format(p.price, p.currency))
+	fmt.Fprintln(w, "Quantity: ", p.quantity)
+	fmt.Fprintln(w, "Specifications:")
 	for specTitle, specInfo := range p.specifications {
-		fmt.Println(specTitle)
+		fmt.Fprintln(w, specTitle)
 		for _, specDesc := range specInfo {
-			fmt.Println(specDesc)
+			fmt.Fprintln(w, specDesc)
 		}
 	}
 }
 
+// String returns a one line summary of the product for logging.
+func (p *product) String() string {
+	return fmt.Sprintf("%s %q (%s) %s %s", p.id, p.name, p.productType, p.price, p.currency)
+}
+
 // Images returns a list of image urls of the product.
 func (p *product) Images() []string {
 	return p.images
 }
 
+// PrimaryImage returns the url of the first image of the product, which is
+// shown as its thumbnail, or an empty string if the product has no images.
+func (p *product) PrimaryImage() string {
+	if len(p.images) == 0 {
+		return ""
+	}
+	return p.images[0]
+}
+
 // IsValid checks if a product is valid and returns true if it is valid.
 func (p *product) IsValid() bool {
-	return p != nil && p.name != "" && p.productType != "" && p.description != "" &&
-		p.price > 0 && len(p.images) != 0 && len(p.specifications) != 0
+	return len(p.Validate()) == 0
+}
+
+// Validate returns an error for every constraint the product does not satisfy.
+func (p *product) Validate() []error {
+	if p == nil {
+		return []error{errors.New("product details are missing")}
+	}
+
+	var errs []error
+	if p.name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+
+	if p.productType == "" {
+		errs = append(errs, errors.New("product type is required"))
+	}
+
+	if p.description == "" {
+		errs = append(errs, errors.New("description is required"))
+	}
+
+	if p.price <= 0 {
+		errs = append(errs, errors.New("price must be positive"))
+	} else if p.price > maxPrice {
+		errs = append(errs, fmt.Errorf("price must not be more than %s", maxPrice))
+	}
+
+	if p.reorderLevel < 0 || p.reorderQuantity < 0 {
+		errs = append(errs, errors.New("reorder level and quantity must not be negative"))
+	}
+
+	if p.availableFrom != nil && p.availableUntil != nil && !p.availableFrom.Before(*p.availableUntil) {
+		errs = append(errs, errors.New("availability window must end after it starts"))
+	}
+
+	if p.costPrice < 0 {
+		errs = append(errs, errors.New("cost price must not be negative"))
+	} else if p.costPrice > maxPrice {
+		errs = append(errs, fmt.Errorf("cost price must not be more than %s", maxPrice))
+	}
+
+	if len(p.images) == 0 {
+		errs = append(errs, errors.New("at least one image is required"))
+	} else if primary := p.PrimaryImage(); !isImageURL(primary) {
+		errs = append(errs, fmt.Errorf("primary image %q is not an absolute http or https url", primary))
+	}
+
+	for i, image := range p.images {
+		if i != 0 && !isImageURL(image) {
+			errs = append(errs, fmt.Errorf("image %q is not an absolute http or https url", image))
+		}
+	}
+
+	if len(p.specifications) == 0 {
+		errs = append(errs, errors.New("at least one specification is required"))
+	}
+
+	return errs
+}
+
+// normalize trims surrounding whitespace from the name of the product and
+// collapses the whitespace inside it to single spaces, and normalizes its
+// image urls with normalizeImages.
+func (p *product) normalize() {
+	p.name = strings.Join(strings.Fields(p.name), " ")
+	p.images = normalizeImages(p.images)
+	p.tags = normalizeTags(p.tags)
+}
+
+// normalizeTags returns tags in lowercase with surrounding whitespace trimmed,
+// and empty and duplicate tags removed, keeping the first occurrence.
+func normalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// normalizeTag returns the form tags are stored in. Tags are not case
+// sensitive.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeImages returns images with surrounding whitespace trimmed from each
+// image url and duplicate urls removed, keeping the first occurrence.
+func normalizeImages(images []string) []string {
+	normalized := make([]string, 0, len(images))
+	seen := make(map[string]bool, len(images))
+	for _, image := range images {
+		image = strings.TrimSpace(image)
+		if !seen[image] {
+			seen[image] = true
+			normalized = append(normalized, image)
+		}
+	}
+	return normalized
+}
+
+// isImageURL checks if image is an absolute http or https url.
+func isImageURL(image string) bool {
+	u, err := url.Parse(image)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Metadata returns a copy of the custom fields of the product.
+func (p *product) Metadata() map[string]string {
+	metadata := make(map[string]string, len(p.metadata))
+	for key, value := range p.metadata {
+		metadata[key] = value
+	}
+	return metadata
+}
+
+// SetMetadata sets the custom field of the product with the specified key to
+// value. An empty value removes the field.
+func (p *product) SetMetadata(key, value string) {
+	if value == "" {
+		delete(p.metadata, key)
+		return
+	}
+
+	if p.metadata == nil {
+		p.metadata = make(map[string]string)
+	}
+	p.metadata[key] = value
+}
+
+// Tags returns a copy of the tags of the product.
+func (p *product) Tags() []string {
+	return append([]string(nil), p.tags...)
+}
+
+// HasTag checks if the product is tagged with tag. Tags are not case
+// sensitive.
+func (p *product) HasTag(tag string) bool {
+	tag = normalizeTag(tag)
+	for _, t := range p.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// CostPrice returns what the store paid for a unit of the product, or zero if
+// it is not known.
+func (p *product) CostPrice() Money {
+	return p.costPrice
+}
+
+// ReorderPolicy returns the quantity at or below which more units of the
+// product should be ordered, and how many. The quantity is zero if the product
+// has no reorder policy.
+func (p *product) ReorderPolicy() (level, quantity int) {
+	return p.reorderLevel, p.reorderQuantity
+}
+
+// AvailabilityWindow returns when the product can start and stop being sold.
+// A nil time means the window is open on that side.
+func (p *product) AvailabilityWindow() (from, until *time.Time) {
+	return p.availableFrom, p.availableUntil
+}
+
+// availableAt checks if the product can be sold at the specified time.
+func (p *product) availableAt(at time.Time) bool {
+	return (p.availableFrom == nil || !at.Before(*p.availableFrom)) &&
+		(p.availableUntil == nil || at.Before(*p.availableUntil))
+}
+
+// ParentID returns the ID of the product this product is a variant of, or zero
+// if it is not a variant.
+func (p *product) ParentID() productID {
+	return p.parentID
 }
 
 // CreatedAt returns when this product was created.
@@ -142,11 +810,47 @@ func (p *product) CreatedAt() *time.Time {
 	return p.createdAt
 }
 
+// DeletedAt returns when the product was deleted from the store, or nil if it
+// has not been.
+func (p *product) DeletedAt() *time.Time {
+	return p.deletedAt
+}
+
 // LastUpdated returns the date this product was last updated.
 func (p *product) LastUpdated() *time.Time {
 	return p.lastUpdated
 }
 
+// deepCopy returns a copy of the product that does not share its images,
+// specifications, metadata or tags with p.
+func (p *product) deepCopy() *product {
+	cp := *p
+	cp.images = append([]string(nil), p.images...)
+	cp.specifications = make(map[string][]string, len(p.specifications))
+	for specTitle, specInfo := range p.specifications {
+		cp.specifications[specTitle] = append([]string(nil), specInfo...)
+	}
+	if p.metadata != nil {
+		cp.metadata = p.Metadata()
+	}
+	cp.tags = append([]string(nil), p.tags...)
+	return &cp
+}
+
+// copyProduct returns a deep copy of a Product of the same concrete type, or
+// nil if the type is not supported.
+func copyProduct(p Product) Product {
+	switch pt := p.(type) {
+	case *product:
+		return pt.deepCopy()
+	case *car:
+		cp := *pt
+		cp.product = pt.product.deepCopy()
+		return &cp
+	}
+	return nil
+}
+
 // car is a store product, embeddeds the product struct and re-implements
 // several methods defined by the Product interface.
 type car struct {
@@ -158,20 +862,68 @@ type car struct {
 }
 
 // Display implements part of the Product interface for car.
-func (c *car) Display() {
-	fmt.Println("Name: ", c.DisplayName())
-	fmt.Println("Make and Model: ", c.make, c.model)
-	fmt.Println("Specifications:")
+func (c *car) Display(w io.Writer) {
+	c.DisplayWith(w, defaultPriceFormatter)
+}
+
+// DisplayWith implements part of the product interface for car.
+func (c *car) DisplayWith(w io.Writer, format PriceFormatter) {
+	fmt.Fprintln(w, "Name: ", c.DisplayName())
+	fmt.Fprintln(w, "Make and Model: ", c.make, c.model)
+	fmt.Fprintln(w, "Price: ", format(c.price, c.currency))
+	fmt.Fprintln(w, "Quantity: ", c.quantity)
+	fmt.Fprintln(w, "Specifications:")
 	for specTitle, specInfo := range c.specifications {
-		fmt.Println(specTitle)
+		fmt.Fprintln(w, specTitle)
 		for _, specDesc := range specInfo {
-			fmt.Println(specDesc)
+			fmt.Fprintln(w, specDesc)
 		}
 	}
 }
 
+// String returns a one line summary of the car for logging.
+func (c *car) String() string {
+	return fmt.Sprintf("%s %q (%s, %s %s %s) %s %s", c.id, c.name, c.productType, c.year, c.make, c.model, c.price, c.currency)
+}
+
 // IsValid implements part of the product interface for car.
 func (c *car) IsValid() bool {
-	return c.product != nil && c.product.IsValid() && c.make != "" &&
-		c.model != "" && c.color != ""
+	return len(c.Validate()) == 0
+}
+
+// Validate implements part of the product interface for car.
+func (c *car) Validate() []error {
+	errs := c.product.Validate()
+	if c.make == "" {
+		errs = append(errs, errors.New("car make is required"))
+	}
+
+	if c.model == "" {
+		errs = append(errs, errors.New("car model is required"))
+	}
+
+	if c.color == "" {
+		errs = append(errs, errors.New("car color is required"))
+	}
+
+	return errs
+}
+
+// ValidationError is returned when a product is not valid. It lists every
+// constraint the product does not satisfy.
+type ValidationError struct {
+	Errors []error
+}
+
+// Is makes a ValidationError match ErrInvalidProduct with errors.Is.
+func (ve *ValidationError) Is(target error) bool {
+	return target == ErrInvalidProduct
+}
+
+func (ve *ValidationError) Error() string {
+	msgs := make([]string, len(ve.Errors))
+	for i, err := range ve.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProductNormalize(t *testing.T) {
+	p := testProduct(t, "  Ford  \t Ecosport ", 1000, 1, WithTags(" SUV", "suv", ""))
+	p.normalize()
+	if got := p.DisplayName(); got != "Ford Ecosport" {
+		t.Fatalf("expected name %q, got %q", "Ford Ecosport", got)
+	}
+	if tags := p.Tags(); len(tags) != 1 || tags[0] != "suv" {
+		t.Fatalf("expected tags [suv], got %v", tags)
+	}
+
+	blank := testProduct(t, " \t ", 1000, 1)
+	blank.normalize()
+	if errs := blank.Validate(); len(errs) == 0 {
+		t.Fatalf("product with a blank name is valid")
+	}
+}
+
+func TestProductValidatePrice(t *testing.T) {
+	tests := []struct {
+		price Money
+		valid bool
+	}{
+		{1, true},
+		{maxPrice, true},
+		{0, false},
+		{-1, false},
+		{maxPrice + 1, false},
+		{math.MaxInt64, false},
+		{math.MinInt64, false},
+	}
+	for _, test := range tests {
+		p := testProduct(t, "Rice", 1000, 1)
+		p.price = test.price
+		if p.IsValid() != test.valid {
+			t.Errorf("IsValid() of product priced %d = %t, want %t", int64(test.price), !test.valid, test.valid)
+		}
+	}
+}
+
+func TestProductValidateImages(t *testing.T) {
+	tests := []struct {
+		name   string
+		images []string
+		valid  bool
+	}{
+		{"https", []string{"https://example.com/a.png"}, true},
+		{"http", []string{"http://example.com/a.png", "https://example.com/b.png"}, true},
+		{"empty", []string{""}, false},
+		{"relative path", []string{"images/a.png"}, false},
+		{"absolute path", []string{"/images/a.png"}, false},
+		{"ftp", []string{"ftp://example.com/a.png"}, false},
+		{"no host", []string{"https:///a.png"}, false},
+		{"invalid later image", []string{"https://example.com/a.png", "ftp://example.com/b.png"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := testProduct(t, "Rice", 1000, 1)
+			p.images = test.images
+			c := &car{product: copyProduct(p).Product(), make: "Ford", model: "Ecosport", color: "Blue", year: "2020"}
+			for _, product := range []Product{p, c} {
+				if product.IsValid() != test.valid {
+					t.Errorf("IsValid() of %T with images %q = %t, want %t", product, test.images, !test.valid, test.valid)
+				}
+			}
+		})
+	}
+}
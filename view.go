@@ -0,0 +1,201 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// productsView is an immutable copy of the products in stock that are within
+// their availability window, built by the first read after a change to the
+// products and shared by the reads that follow until the next change. Reads
+// of a current view take no lock. A new view only rebuilds the product types
+// that changed since the last view was built, from copies of the products
+// that are only made again for the products that changed.
+type productsView struct {
+	// byType are the products in stock grouped by product type.
+	byType map[string]*typeView
+	// staleAt is when the view stops showing the products in stock, when
+	// the earliest reservation expires and its units return to stock, or
+	// a product's availability window opens or closes. It is nil if there
+	// is no such time.
+	staleAt *time.Time
+
+	// all are the products of every type, gathered by the first read of
+	// all the products.
+	allOnce sync.Once
+	all     typeView
+}
+
+// typeView is the part of a productsView with the products of a single type.
+type typeView struct {
+	products []Product
+	// cost is the total cost of the units in stock of the products.
+	cost Money
+	// staleAt is when the availability window of one of the products in
+	// stock of the type opens or closes, or nil if there is no such time.
+	staleAt *time.Time
+}
+
+// current checks if the view still shows the products in stock at the
+// specified time.
+func (v *productsView) current(now time.Time) bool {
+	return v != nil && (v.staleAt == nil || now.Before(*v.staleAt))
+}
+
+// allProducts returns the products of every type in the view.
+func (v *productsView) allProducts() *typeView {
+	v.allOnce.Do(func() {
+		for _, tv := range v.byType {
+			v.all.products = append(v.all.products, tv.products...)
+			v.all.cost = v.all.cost.Add(tv.cost)
+		}
+	})
+	return &v.all
+}
+
+// current checks if the products in the type view are still the ones within
+// their availability window at the specified time.
+func (tv *typeView) current(now time.Time) bool {
+	return tv.staleAt == nil || now.Before(*tv.staleAt)
+}
+
+// earliest returns the earlier of at and the time t points to, or at if t is
+// nil.
+func earliest(t *time.Time, at time.Time) *time.Time {
+	if t == nil || at.Before(*t) {
+		return &at
+	}
+	return t
+}
+
+// productsView returns a view of the products in stock, building a new one if
+// the products have changed since the last view was built.
+func (s *store) productsView() *productsView {
+	if view := s.view.Load(); view.current(s.now()) {
+		return view
+	}
+
+	s.releaseExpiredReservations()
+
+	// The view is built and stored with the read lock held, so no product
+	// can change, and no older view can be stored, in between. viewMtx
+	// keeps concurrent reads from building views, and updating the copies,
+	// at the same time.
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	s.viewMtx.Lock()
+	defer s.viewMtx.Unlock()
+
+	now := s.now()
+	if view := s.view.Load(); view.current(now) {
+		return view
+	}
+
+	changedTypes := s.updateViewCopiesLocked()
+	view := &productsView{byType: make(map[string]*typeView, len(s.byType))}
+	for productType, IDs := range s.byType {
+		var tv *typeView
+		if s.lastView != nil {
+			tv = s.lastView.byType[productType]
+		}
+		if tv == nil || changedTypes[productType] || !tv.current(now) {
+			tv = s.buildTypeViewLocked(IDs, now)
+		}
+
+		view.byType[productType] = tv
+		if tv.staleAt != nil {
+			view.staleAt = earliest(view.staleAt, *tv.staleAt)
+		}
+	}
+
+	for _, r := range s.reservations {
+		view.staleAt = earliest(view.staleAt, r.expiresAt)
+	}
+
+	s.lastView = view
+	s.view.Store(view)
+	return view
+}
+
+// buildTypeViewLocked returns a type view of the products in stock with the
+// specified IDs from their copies in viewCopies. The read lock and viewMtx
+// must be held.
+func (s *store) buildTypeViewLocked(IDs map[productID]bool, now time.Time) *typeView {
+	tv := &typeView{products: make([]Product, 0, len(IDs))}
+	for ID := range IDs {
+		cp := s.viewCopies[ID]
+		product := cp.Product()
+		if product.availableFrom != nil && now.Before(*product.availableFrom) {
+			tv.staleAt = earliest(tv.staleAt, *product.availableFrom)
+		}
+		if product.availableUntil != nil && now.Before(*product.availableUntil) {
+			tv.staleAt = earliest(tv.staleAt, *product.availableUntil)
+		}
+		if !sellable(cp, now) {
+			continue
+		}
+
+		tv.products = append(tv.products, cp)
+		tv.cost = tv.cost.Add(cp.Price().Mul(int64(cp.Quantity())))
+	}
+	return tv
+}
+
+// updateViewCopiesLocked brings the copies of the products in stock that views
+// are built from up to date, copying only the products that changed since the
+// copies were last updated, and returns the product types with changed
+// products. The read lock and viewMtx must be held.
+func (s *store) updateViewCopiesLocked() map[string]bool {
+	changedTypes := make(map[string]bool)
+	if s.viewCopies == nil {
+		s.viewCopies = make(map[productID]Product, len(s.products))
+		for ID, p := range s.products {
+			s.viewCopies[ID] = copyProduct(p)
+		}
+		s.viewChanged = nil
+		return changedTypes
+	}
+
+	for ID := range s.viewChanged {
+		// The product may have changed type, so both its old and new
+		// types are rebuilt.
+		if cp, ok := s.viewCopies[ID]; ok {
+			changedTypes[cp.Type()] = true
+		}
+
+		if p, ok := s.products[ID]; ok {
+			s.viewCopies[ID] = copyProduct(p)
+			changedTypes[p.Type()] = true
+		} else {
+			delete(s.viewCopies, ID)
+		}
+	}
+	s.viewChanged = nil
+	return changedTypes
+}
+
+// invalidateViewLocked discards the current view of the products in stock
+// after the product with the specified ID was changed, added or removed. It
+// must be called whenever a product in stock is changed. The write lock must
+// be held.
+func (s *store) invalidateViewLocked(ID productID) {
+	s.view.Store(nil)
+	if s.viewCopies == nil {
+		return
+	}
+
+	if s.viewChanged == nil {
+		s.viewChanged = make(map[productID]bool)
+	}
+	s.viewChanged[ID] = true
+}
+
+// resetViewLocked discards the current view of the products in stock and
+// everything the next view could reuse, after all the products in stock are
+// replaced. The write lock must be held.
+func (s *store) resetViewLocked() {
+	s.view.Store(nil)
+	s.lastView = nil
+	s.viewCopies = nil
+	s.viewChanged = nil
+}
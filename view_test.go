@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProductsViewReusesUnchangedCopies(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 2), testProduct(t, "Beans", 3000, 1))
+
+	before, total := s.availableProducts("")
+	if len(before) != 2 || total != 5000 {
+		t.Fatalf("expected 2 products costing 50.00, got %d costing %s", len(before), total)
+	}
+
+	if err := s.restock(IDs[0], 1); err != nil {
+		t.Fatalf("restock error: %v", err)
+	}
+
+	after, total := s.availableProducts("")
+	if len(after) != 2 || total != 6000 {
+		t.Fatalf("expected 2 products costing 60.00, got %d costing %s", len(after), total)
+	}
+
+	copies := make(map[productID]Product)
+	for _, p := range before {
+		copies[p.ID()] = p
+	}
+	for _, p := range after {
+		switch p.ID() {
+		case IDs[0]:
+			if p == copies[p.ID()] || p.Quantity() != 3 {
+				t.Fatalf("restocked product was not copied again")
+			}
+		case IDs[1]:
+			if p != copies[p.ID()] {
+				t.Fatalf("unchanged product was copied again")
+			}
+		}
+	}
+
+	if _, err := s.deleteProducts(IDs[1]); err != nil {
+		t.Fatalf("deleteProducts error: %v", err)
+	}
+	if products, _ := s.availableProducts(""); len(products) != 1 || products[0].ID() != IDs[0] {
+		t.Fatalf("deleted product is still in the view")
+	}
+}
+
+func TestAvailableProductsAreReadOnlyCopies(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 2), testProduct(t, "Beans", 3000, 1))
+
+	products, _ := s.availableProducts("")
+	if len(products) != 2 {
+		t.Fatalf("expected 2 products, got %d", len(products))
+	}
+	for _, p := range products {
+		if p == s.products[p.ID()] {
+			t.Fatalf("availableProducts returned the store's product %s", p.ID().String())
+		}
+	}
+
+	// The slice is not shared, so changing it does not change the view.
+	products[0], products[1] = nil, nil
+	again, total := s.availableProducts("")
+	if len(again) != 2 || again[0] == nil || again[1] == nil || total != 5000 {
+		t.Fatalf("changing the returned slice changed the view: %v costing %s", again, total)
+	}
+
+	// Changing the store does not change products already returned.
+	if err := s.restock(IDs[0], 1); err != nil {
+		t.Fatalf("restock error: %v", err)
+	}
+	for _, p := range again {
+		if p.ID() == IDs[0] && p.Quantity() != 2 {
+			t.Fatalf("restock changed a product returned before it, quantity %d", p.Quantity())
+		}
+	}
+	if p := s.product(IDs[0]); p.Quantity() != 3 {
+		t.Fatalf("expected 3 units after restocking, got %d", p.Quantity())
+	}
+}
+
+func TestProductsViewTypeChange(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 2), testProduct(t, "Beans", 3000, 1))
+	if products, _ := s.availableProducts("test"); len(products) != 2 {
+		t.Fatalf("expected 2 products of type test, got %d", len(products))
+	}
+
+	err := s.updateProduct(IDs[0], func(p *product) error {
+		p.productType = "grain"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("updateProduct error: %v", err)
+	}
+
+	if products, total := s.availableProducts("test"); len(products) != 1 || total != 3000 {
+		t.Fatalf("expected 1 product of type test costing 30.00, got %d costing %s", len(products), total)
+	}
+	if products, total := s.availableProducts("grain"); len(products) != 1 || total != 2000 {
+		t.Fatalf("expected 1 product of type grain costing 20.00, got %d costing %s", len(products), total)
+	}
+	if products, total := s.availableProducts(""); len(products) != 2 || total != 5000 {
+		t.Fatalf("expected 2 products costing 50.00, got %d costing %s", len(products), total)
+	}
+}
+
+func TestProductsViewAvailabilityWindow(t *testing.T) {
+	s, _ := testStore(t)
+	clock := newFakeClock()
+	s.clock = clock
+	from := clock.Now().Add(time.Hour)
+	mustAddProducts(t, s,
+		testProduct(t, "Rice", 1000, 1),
+		testProduct(t, "Beans", 3000, 1, WithAvailabilityWindow(&from, nil)),
+	)
+
+	if products, _ := s.availableProducts("test"); len(products) != 1 {
+		t.Fatalf("expected 1 product before the window opens, got %d", len(products))
+	}
+
+	clock.advance(time.Hour)
+	if products, _ := s.availableProducts("test"); len(products) != 2 {
+		t.Fatalf("expected 2 products after the window opens, got %d", len(products))
+	}
+}
+
+// TestProductsViewConcurrentWrites reads the products view while products are
+// restocked. Run with -race.
+func TestProductsViewConcurrentWrites(t *testing.T) {
+	s, _ := testStore(t)
+	IDs := mustAddProducts(t, s, testProduct(t, "Rice", 1000, 1), testProduct(t, "Beans", 3000, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := s.restock(IDs[(i+j)%len(IDs)], 1); err != nil {
+					t.Errorf("restock error: %v", err)
+					return
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if products, _ := s.availableProducts(""); len(products) != 2 {
+					t.Errorf("expected 2 products, got %d", len(products))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, total := s.availableProducts(""); total != 1000*201+3000*201 {
+		t.Fatalf("view total %s does not match the stock", total)
+	}
+}
+
+// scanAvailableProducts is availableProducts without the products view, for
+// comparison in benchmarks.
+func (s *store) scanAvailableProducts(productType string) ([]Product, Money) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	now := s.now()
+	var products []Product
+	var total Money
+	for _, p := range s.productsOfTypeLocked(productType) {
+		if !sellable(p, now) {
+			continue
+		}
+		cp := copyProduct(p)
+		products = append(products, cp)
+		total = total.Add(cp.Price().Mul(int64(cp.Quantity())))
+	}
+	return products, total
+}
+
+// benchmarkStore returns a store with n products, spread over 10 types.
+func benchmarkStore(b *testing.B, n int) (*store, []productID) {
+	b.Helper()
+	s, _ := testStore(b)
+	products := make([]Product, n)
+	for i := range products {
+		products[i] = testProduct(b, fmt.Sprintf("Product %d", i), Money(1000+i), 10)
+		products[i].Product().productType = fmt.Sprintf("type%d", i%10)
+	}
+	return s, mustAddProducts(b, s, products...)
+}
+
+// BenchmarkAvailableProducts compares reading the products view with scanning
+// the products under the read lock, on a store that is only read and on one
+// where every read follows a write.
+func BenchmarkAvailableProducts(b *testing.B) {
+	reads := map[string]func(*store, string) ([]Product, Money){
+		"view": (*store).availableProducts,
+		"scan": (*store).scanAvailableProducts,
+	}
+
+	for _, name := range []string{"view", "scan"} {
+		read := reads[name]
+		b.Run(name+"/read-only", func(b *testing.B) {
+			s, _ := benchmarkStore(b, 10000)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				read(s, "type0")
+			}
+		})
+
+		b.Run(name+"/write-heavy", func(b *testing.B) {
+			s, IDs := benchmarkStore(b, 10000)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.restock(IDs[i%len(IDs)], 1); err != nil {
+					b.Fatalf("restock error: %v", err)
+				}
+				read(s, "type0")
+			}
+		})
+	}
+}